@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var accessibleDefault = flag.Bool("accessible", false, "start every session in accessible mode: plain line-by-line output without ANSI codes or emoji")
+
+// accessibleBacklog is how many recent messages are printed when a client
+// enters accessible mode.
+const accessibleBacklog = 20
+
+// Accessible mode is for screen readers and braille displays. Instead of
+// redrawing the screen, render prints each new message once as
+// "HH:MM:SS nick: text" and echoes typed input after a "> " prompt.
+
+// formatAccessibleMessage renders msg as a single line without escape
+// codes or emoji.
+func formatAccessibleMessage(msg Message, opts viewOptions) string {
+	tz := opts.tz
+	if tz == nil {
+		tz = time.UTC
+	}
+	text := strings.Join(strings.Fields(stripEmoji(stripANSI(msg.Text))), " ")
+	if msg.ReplyTo != 0 {
+		text = fmt.Sprintf("(reply to message %d) %s", msg.ReplyTo, text)
+	}
+	return fmt.Sprintf("%s %s: %s", msg.Time.In(tz).Format(opts.timeLayout()), msg.Nick, text)
+}
+
+// stripEmoji removes pictographs, dingbats and the joiners and variation
+// selectors used to build emoji sequences.
+func stripEmoji(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, symbols
+			r >= 0x2600 && r <= 0x27BF, // miscellaneous symbols, dingbats
+			r >= 0xFE00 && r <= 0xFE0F, // variation selectors
+			r == 0x200D:                // zero width joiner
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// renderAccessible prints unseen messages and keeps the echoed input line
+// in step with inputBuffer. The caller holds renderMu.
+func (c *Client) renderAccessible(input []rune, opts viewOptions) error {
+	var b strings.Builder
+	msgs := c.unseenMessages()
+	if len(msgs) > 0 {
+		// Messages go on their own lines; reprint the prompt below them.
+		b.WriteString("\r\n")
+		for _, msg := range msgs {
+			b.WriteString(formatAccessibleMessage(msg, opts))
+			b.WriteString("\r\n")
+		}
+		b.WriteString("> " + string(input))
+	} else {
+		echoed := c.accessibleEcho
+		switch {
+		case len(input) >= len(echoed) && string(input[:len(echoed)]) == string(echoed):
+			b.WriteString(string(input[len(echoed):]))
+		case len(input) < len(echoed) && string(echoed[:len(input)]) == string(input):
+			b.WriteString(strings.Repeat("\b \b", len(echoed)-len(input)))
+		default:
+			// The line was sent or replaced.
+			b.WriteString("\r\n> " + string(input))
+		}
+	}
+	c.accessibleEcho = input
+
+	if b.Len() == 0 {
+		return nil
+	}
+	return c.writeFrame([]byte(b.String()))
+}
+
+// setAccessible switches c between the full-screen view and accessible
+// mode. Entering the mode replays the last few messages.
+func (c *Client) setAccessible(on bool) {
+	c.renderMu.Lock()
+	last := c.server.LastMessageID()
+	c.plainLastID = 0
+	if last > accessibleBacklog {
+		c.plainLastID = last - accessibleBacklog
+	}
+	c.plainLastNotice = now()
+	c.accessibleEcho = nil
+	c.renderPaused = !on // clear the screen when the full view comes back
+	c.renderMu.Unlock()
+
+	c.mu.Lock()
+	c.accessibleMode = on
+	c.mu.Unlock()
+	c.Notify()
+}
+
+func (c *Client) cmdAccessible(arg string) {
+	switch strings.ToLower(arg) {
+	case "on":
+		c.setAccessible(true)
+		c.SendNotice("Accessible mode on. Use /accessible off to return to the full-screen view.")
+	case "off":
+		c.setAccessible(false)
+		c.SendNotice("Accessible mode off.")
+	default:
+		c.SendNotice("Usage: /accessible on|off")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	adminIPs        = flag.String("admin-ip", "", "comma-separated IP addresses whose sessions may use admin commands")
+	adminConfigPath = flag.String("admin-config", "", "path to a YAML file listing admin ips and public key fingerprints (reloaded on SIGHUP)")
+)
+
+// isAdminIP reports whether ip is listed in -admin-ip.
+func isAdminIP(ip string) bool {
+	for _, admin := range strings.Split(*adminIPs, ",") {
+		if strings.TrimSpace(admin) == ip && ip != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminConfig holds the admin IPs and key fingerprints last loaded from
+// -admin-config. The file looks like:
+//
+//	ips:
+//	  - 192.0.2.10
+//	fingerprints:
+//	  - SHA256:uS6Ck8d0Gq1u3Vd3...
+type AdminConfig struct {
+	mu           sync.RWMutex
+	path         string
+	ips          map[string]struct{}
+	fingerprints map[string]struct{}
+}
+
+var adminConfig = &AdminConfig{}
+
+// Load (re)reads the config file. An empty path clears the lists.
+func (a *AdminConfig) Load(path string) error {
+	ips := make(map[string]struct{})
+	fingerprints := make(map[string]struct{})
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := parseAdminConfig(f, ips, fingerprints); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	a.mu.Lock()
+	a.path = path
+	a.ips = ips
+	a.fingerprints = fingerprints
+	a.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the file passed to the last Load call.
+func (a *AdminConfig) Reload() error {
+	a.mu.RLock()
+	path := a.path
+	a.mu.RUnlock()
+	return a.Load(path)
+}
+
+// Check reports whether c may use admin commands, either because its IP
+// or its public key fingerprint is listed, or its IP is in -admin-ip.
+func (a *AdminConfig) Check(c *Client) bool {
+	return a.CheckIdentity(c.ip, c.pubKeyFingerprint)
+}
+
+// CheckIdentity is Check for a session that has no Client, such as the
+// export subsystem. fingerprint may be empty.
+func (a *AdminConfig) CheckIdentity(ip, fingerprint string) bool {
+	if isAdminIP(ip) {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if _, ok := a.ips[ip]; ok {
+		return true
+	}
+	if fingerprint == "" {
+		return false
+	}
+	_, ok := a.fingerprints[fingerprint]
+	return ok
+}
+
+// parseAdminConfig reads the small YAML subset used by -admin-config: the
+// top-level keys "ips" and "fingerprints", each holding a block list.
+func parseAdminConfig(r io.Reader, ips, fingerprints map[string]struct{}) error {
+	var section map[string]struct{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case line == "ips:":
+			section = ips
+		case line == "fingerprints:":
+			section = fingerprints
+		case strings.HasPrefix(line, "- ") && section != nil:
+			value := strings.Trim(strings.TrimSpace(line[2:]), `"'`)
+			if value != "" {
+				section[value] = struct{}{}
+			}
+		default:
+			return fmt.Errorf("line %d: unexpected %q", lineNo, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// IsAdmin reports whether c currently has admin rights. It is evaluated on
+// every call so that a SIGHUP reload takes effect for connected sessions.
+func (c *Client) IsAdmin() bool {
+	return adminConfig.Check(c)
+}
+
+// BroadcastToAdmins sends msg as a private notice to every connected admin,
+// for operational details regular users should not see.
+func (cs *ChatServer) BroadcastToAdmins(msg string) {
+	for _, c := range cs.clientSnapshot() {
+		if c.IsAdmin() {
+			c.SendNotice(msg)
+		}
+	}
+}
+
+// requireAdmin replies with an error notice and returns false if c is not
+// an admin.
+func (c *Client) requireAdmin() bool {
+	if c.IsAdmin() {
+		return true
+	}
+	c.SendNotice("Permission denied: admin only.")
+	return false
+}
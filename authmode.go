@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	"golang.org/x/crypto/bcrypt"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	authModeFlag       = flag.String("auth-mode", "none", "SSH authentication: none (anyone may join), publickey (keys from -authorized-keys or certificates from -user-ca), password (-password-file), or any (publickey or password)")
+	authorizedKeysPath = flag.String("authorized-keys", "", "authorized_keys file of user public keys allowed to join in -auth-mode publickey/any")
+	passwordFilePath   = flag.String("password-file", "", "file of user:bcrypt-hash lines (e.g. from htpasswd -B) used in -auth-mode password/any")
+)
+
+// AuthConfig is the parsed -auth-mode and the credentials it needs.
+type AuthConfig struct {
+	mode      string
+	keys      map[string]struct{} // marshaled public keys from -authorized-keys
+	passwords map[string][]byte   // user -> bcrypt hash from -password-file
+	checker   *gossh.CertChecker  // from -user-ca, may be nil
+}
+
+// loadAuthConfig validates -auth-mode and loads the files it requires.
+// checker is the -user-ca certificate checker, or nil.
+func loadAuthConfig(mode string, checker *gossh.CertChecker) (*AuthConfig, error) {
+	a := &AuthConfig{mode: mode, checker: checker}
+	switch mode {
+	case "none":
+		return a, nil
+	case "publickey", "password", "any":
+	default:
+		return nil, fmt.Errorf("unknown -auth-mode %q (want none, publickey, password or any)", mode)
+	}
+
+	if mode != "password" && *authorizedKeysPath != "" {
+		keys, err := loadAuthorizedKeys(*authorizedKeysPath)
+		if err != nil {
+			return nil, fmt.Errorf("-authorized-keys: %w", err)
+		}
+		a.keys = make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			a.keys[string(key.Marshal())] = struct{}{}
+		}
+	}
+	if mode != "publickey" && *passwordFilePath != "" {
+		passwords, err := loadPasswordFile(*passwordFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("-password-file: %w", err)
+		}
+		a.passwords = passwords
+	}
+
+	keysOK := a.keys != nil || checker != nil
+	passwordsOK := a.passwords != nil
+	switch {
+	case mode == "publickey" && !keysOK:
+		return nil, fmt.Errorf("-auth-mode publickey needs -authorized-keys or -user-ca")
+	case mode == "password" && !passwordsOK:
+		return nil, fmt.Errorf("-auth-mode password needs -password-file")
+	case mode == "any" && !keysOK && !passwordsOK:
+		return nil, fmt.Errorf("-auth-mode any needs -authorized-keys, -user-ca or -password-file")
+	}
+	return a, nil
+}
+
+// loadPasswordFile parses "user:hash" lines, where hash is a bcrypt hash.
+// Blank lines and lines starting with # are skipped.
+func loadPasswordFile(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" || !strings.HasPrefix(hash, "$2") {
+			return nil, fmt.Errorf("line %d: want user:bcrypt-hash", lineNo)
+		}
+		passwords[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// Configure installs the handlers for the auth mode on srv. Rejections are
+// logged and reported to the admins of cs.
+func (a *AuthConfig) Configure(srv *ssh.Server, cs *ChatServer) {
+	if a.mode == "none" {
+		// Anyone may join; -user-ca only adds certificate details.
+		if a.checker != nil {
+			configureCertAuth(srv, a.checker, cs)
+		}
+		return
+	}
+	// With no KeyboardInteractiveHandler, and no PasswordHandler outside the
+	// password modes, gliderlabs/ssh does not offer those methods at all, so
+	// clients are never prompted for credentials that cannot succeed.
+	if a.mode == "publickey" || a.mode == "any" {
+		srv.PublicKeyHandler = func(ctx ssh.Context, key ssh.PublicKey) bool {
+			if err := a.checkPublicKey(ctx, key); err != nil {
+				reportAuthFailure(cs, ctx, "public key", err)
+				return false
+			}
+			return true
+		}
+	}
+	if a.mode == "password" || a.mode == "any" {
+		srv.PasswordHandler = func(ctx ssh.Context, password string) bool {
+			if err := a.checkPassword(ctx.User(), password); err != nil {
+				reportAuthFailure(cs, ctx, "password", err)
+				return false
+			}
+			return true
+		}
+	}
+}
+
+// checkPublicKey accepts keys listed in -authorized-keys and certificates
+// signed by a -user-ca authority.
+func (a *AuthConfig) checkPublicKey(ctx ssh.Context, key ssh.PublicKey) error {
+	if _, isCert := key.(*gossh.Certificate); isCert {
+		if a.checker == nil {
+			return fmt.Errorf("certificates are not accepted (no -user-ca)")
+		}
+		_, err := a.checker.Authenticate(connMetadata{ctx}, key)
+		return err
+	}
+	if _, ok := a.keys[string(key.Marshal())]; !ok {
+		return fmt.Errorf("key %s is not registered", gossh.FingerprintSHA256(key))
+	}
+	return nil
+}
+
+// checkPassword compares password with the user's bcrypt hash.
+func (a *AuthConfig) checkPassword(user, password string) error {
+	hash, ok := a.passwords[user]
+	if !ok {
+		return fmt.Errorf("unknown user")
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return fmt.Errorf("wrong password")
+	}
+	return nil
+}
+
+// reportAuthFailure logs a rejected login and tells the admins.
+func reportAuthFailure(cs *ChatServer, ctx ssh.Context, method string, err error) {
+	log.Printf("%s rejected for user=%q from %s: %v", method, ctx.User(), ctx.RemoteAddr(), err)
+	cs.BroadcastToAdmins(fmt.Sprintf("Authentication failure: %s rejected for %q from %s: %v", method, ctx.User(), ctx.RemoteAddr(), err))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// /block <nick> hides nick's messages from the blocker's view and keeps the
+// blocker's messages from ringing the blocked user's bell. The blocked user
+// still sees the blocker's messages in the shared history.
+
+// hasBlocked reports whether c has blocked nick.
+func (c *Client) hasBlocked(nick string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.blocked[strings.ToLower(nick)]
+	return ok
+}
+
+// isBlockedBy reports whether the user named nick has blocked c.
+func (c *Client) isBlockedBy(nick string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.blockedBy[strings.ToLower(nick)]
+	return ok
+}
+
+// filterBlocked drops user messages from blocked nicks. blocked must not be
+// modified while filterBlocked runs.
+func filterBlocked(msgs []Message, blocked map[string]struct{}) []Message {
+	if len(blocked) == 0 {
+		return msgs
+	}
+	out := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if _, ok := blocked[strings.ToLower(msg.Nick)]; ok && msg.Type == MsgTypeUser {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func (c *Client) cmdBlock(arg string) {
+	if arg == "" {
+		c.mu.Lock()
+		nicks := make([]string, 0, len(c.blocked))
+		for nick := range c.blocked {
+			nicks = append(nicks, nick)
+		}
+		c.mu.Unlock()
+		if len(nicks) == 0 {
+			c.SendNotice("You have not blocked anyone. Usage: /block <nick>")
+			return
+		}
+		sort.Strings(nicks)
+		c.SendNotice("Blocked: " + strings.Join(nicks, ", "))
+		return
+	}
+	target := c.server.FindClient(arg)
+	if target == nil {
+		c.SendNotice(fmt.Sprintf("No user named %s", arg))
+		return
+	}
+	if target == c {
+		c.SendNotice("You cannot block yourself.")
+		return
+	}
+	targetNick := target.Nick()
+
+	c.mu.Lock()
+	if c.blocked == nil {
+		c.blocked = make(map[string]struct{})
+	}
+	c.blocked[strings.ToLower(targetNick)] = struct{}{}
+	nick := c.nickname
+	c.mu.Unlock()
+
+	target.mu.Lock()
+	if target.blockedBy == nil {
+		target.blockedBy = make(map[string]struct{})
+	}
+	target.blockedBy[strings.ToLower(nick)] = struct{}{}
+	target.mu.Unlock()
+
+	c.SendNotice(fmt.Sprintf("Blocked %s. Use /unblock %s to undo.", targetNick, targetNick))
+}
+
+func (c *Client) cmdUnblock(arg string) {
+	if arg == "" {
+		c.SendNotice("Usage: /unblock <nick>")
+		return
+	}
+	key := strings.ToLower(arg)
+	c.mu.Lock()
+	_, ok := c.blocked[key]
+	delete(c.blocked, key)
+	nick := c.nickname
+	c.mu.Unlock()
+	if !ok {
+		c.SendNotice(fmt.Sprintf("%s is not blocked.", arg))
+		return
+	}
+	if target := c.server.FindClient(arg); target != nil {
+		target.mu.Lock()
+		delete(target.blockedBy, strings.ToLower(nick))
+		target.mu.Unlock()
+	}
+	c.SendNotice(fmt.Sprintf("Unblocked %s.", arg))
+}
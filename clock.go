@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"time"
+)
+
+var serverTimezone = flag.String("timezone", "", "IANA timezone for message and log timestamps (default: the process's local zone)")
+
+// serverLocation is the zone returned by now. It is set once in main.
+var serverLocation = time.Local
+
+// now returns the current time in the server's configured timezone. Use it
+// for anything shown to users or written to the log.
+func now() time.Time {
+	return time.Now().In(serverLocation)
+}
+
+// tzLogWriter prefixes every log line with a timestamp in serverLocation,
+// including the UTC offset. It replaces the log package's own timestamp.
+type tzLogWriter struct {
+	w io.Writer
+}
+
+func (lw tzLogWriter) Write(p []byte) (int, error) {
+	line := append([]byte(now().Format("2006/01/02 15:04:05 -0700 ")), p...)
+	if _, err := lw.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
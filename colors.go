@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+var (
+	systemColorFlag = flag.Int("system-color", 37, "ANSI color code for server messages and notices")
+	joinColorFlag   = flag.Int("join-color", 32, "ANSI color code for join announcements")
+	leaveColorFlag  = flag.Int("leave-color", 32, "ANSI color code for leave announcements")
+	banColorFlag    = flag.Int("ban-color", 31, "ANSI color code for ban announcements")
+)
+
+// SystemColorConfig holds the nick colors used for server-authored messages.
+type SystemColorConfig struct {
+	System int
+	Join   int
+	Leave  int
+	Ban    int
+}
+
+// systemColors is filled from the flags by loadSystemColors.
+var systemColors = SystemColorConfig{System: 37, Join: 32, Leave: 32, Ban: 31}
+
+// loadSystemColors copies the color flags into systemColors, replacing
+// values that are not foreground color codes (30-37, 90-97) with defaults.
+func loadSystemColors() {
+	pick := func(name string, v, def int) int {
+		if (v >= 30 && v <= 37) || (v >= 90 && v <= 97) {
+			return v
+		}
+		log.Printf("-%s must be an ANSI foreground color (30-37 or 90-97); using %d", name, def)
+		return def
+	}
+	systemColors = SystemColorConfig{
+		System: pick("system-color", *systemColorFlag, 37),
+		Join:   pick("join-color", *joinColorFlag, 32),
+		Leave:  pick("leave-color", *leaveColorFlag, 32),
+		Ban:    pick("ban-color", *banColorFlag, 31),
+	}
+}
+
+// colorNames names the entries of colors, for /color.
+var colorNames = map[int]string{
+	31: "red",
+	32: "green",
+	33: "yellow",
+	34: "blue",
+	35: "magenta",
+	36: "cyan",
+}
+
+// colorRGB is the 24-bit value shown for each color in true-color terminals.
+var colorRGB = map[int][3]uint8{
+	31: {205, 49, 49},
+	32: {13, 188, 121},
+	33: {229, 229, 16},
+	34: {36, 114, 200},
+	35: {188, 63, 188},
+	36: {17, 168, 205},
+}
+
+// parseColor accepts a color name or ANSI code from colors.
+func parseColor(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, code := range colors {
+		if colorNames[code] == s || strconv.Itoa(code) == s {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// colorSamples lists every available color, each drawn in its own color,
+// wrapped so that no line is wider than width visible columns.
+func colorSamples(width int, trueColor bool) string {
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	for _, code := range colors {
+		label := fmt.Sprintf("%s (%d)", colorNames[code], code)
+		sample := fmt.Sprintf("\x1b[%dm%s\x1b[0m", code, label)
+		if trueColor {
+			rgb := colorRGB[code]
+			label = fmt.Sprintf("%s (%d) #%02x%02x%02x", colorNames[code], code, rgb[0], rgb[1], rgb[2])
+			sample = fmt.Sprintf("\x1b[38;2;%d;%d;%dm%s\x1b[0m", rgb[0], rgb[1], rgb[2], label)
+		}
+		if lineWidth > 0 && lineWidth+2+len(label) > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		if lineWidth > 0 {
+			line.WriteString("  ")
+			lineWidth += 2
+		}
+		line.WriteString(sample)
+		lineWidth += len(label)
+	}
+	lines = append(lines, line.String())
+	return strings.Join(lines, "\n")
+}
+
+func (c *Client) cmdColor(arg string) {
+	if arg == "" || strings.EqualFold(arg, "list") {
+		c.mu.Lock()
+		// Leave room for the "[15:04:05] server: " notice prefix.
+		width := c.width - len("server") - 13
+		trueColor := c.caps.TrueColor
+		c.mu.Unlock()
+		c.SendNotice("Available colors (/color <name>):\n" + colorSamples(width, trueColor))
+		return
+	}
+	code, ok := parseColor(arg)
+	if !ok {
+		c.SendNotice(fmt.Sprintf("Unknown color %q. Try /color list", arg))
+		return
+	}
+	c.mu.Lock()
+	c.color = code
+	c.mu.Unlock()
+	c.SendNotice(fmt.Sprintf("Your color is now \x1b[%dm%s\x1b[0m", code, colorNames[code]))
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// handleCommand dispatches a slash command. It returns false if the text is
+// not a known command, in which case it is sent as a normal message.
+// Command names are case-insensitive.
+func (c *Client) handleCommand(text string) bool {
+	name, args, _ := strings.Cut(text, " ")
+	name = strings.ToLower(name)
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case "/ban":
+		c.cmdBan(args)
+	case "/motd":
+		c.cmdMOTD()
+	case "/stats":
+		c.cmdStats()
+	case "/top":
+		c.cmdTop()
+	case "/uptime":
+		c.cmdUptime()
+	case "/info":
+		c.cmdInfo()
+	case "/whois":
+		c.cmdWhois(args)
+	case "/version":
+		c.SendNotice(versionString())
+	case "/shutdown":
+		c.cmdShutdown(args)
+	case "/report":
+		c.cmdReport(args)
+	case "/reports":
+		c.cmdReports()
+	case "/dismiss":
+		c.cmdDismiss(args)
+	case "/export":
+		c.cmdExport(args)
+	case "/save":
+		c.cmdSave(args)
+	case "/timezone":
+		c.cmdTimezone(args)
+	case "/time":
+		c.cmdTime(args)
+	case "/color":
+		c.cmdColor(args)
+	case "/rename":
+		c.cmdRename(args)
+	case "/accessible":
+		c.cmdAccessible(args)
+	case "/format":
+		c.cmdFormat(args)
+	case "/slowmode":
+		c.cmdSlowMode(args)
+	case "/debug":
+		c.cmdDebug()
+	case "/kick-ghost":
+		c.cmdKickGhost()
+	case "/reply":
+		c.cmdReply(args)
+	case "/seen":
+		c.cmdSeen(args)
+	case "/block":
+		c.cmdBlock(args)
+	case "/unblock":
+		c.cmdUnblock(args)
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *Client) cmdBan(target string) {
+	if !c.requireAdmin() {
+		return
+	}
+	// Allow just IP (IPv4/IPv6). No CIDR support for simplicity.
+	if ip := net.ParseIP(target); ip == nil {
+		c.SendNotice("Invalid IP address")
+		return
+	}
+	disconnected := c.state.banWithReason(target, "manual ban", c.Nick())
+	c.SendNotice(fmt.Sprintf("Disconnected %d session(s).", disconnected))
+}
+
+func (c *Client) cmdMOTD() {
+	text := motd.Text()
+	if text == "" {
+		c.SendNotice("No MOTD set.")
+		return
+	}
+	c.SendNotice(text)
+}
+
+func (c *Client) cmdStats() {
+	c.SendNotice(fmt.Sprintf("Users: %d\nMessages: %d\nUptime: %s\nBan checks: %d rejected, %d allowed\nRate limiter: %d allowed, %d denied\nThrottled connections: %d\n%s",
+		c.server.ClientCount(), c.server.LastMessageID(), formatDuration(time.Since(serverStartTime)),
+		c.state.Bans.Hits.Load(), c.state.Bans.Misses.Load(),
+		c.state.RateLimiter.AllowedCount.Load(), c.state.RateLimiter.DeniedCount.Load(),
+		c.state.Throttle.RejectedCount(),
+		formatTopSenders(c.server.TopSenders(5))))
+}
+
+func (c *Client) cmdUptime() {
+	c.SendNotice(fmt.Sprintf("Server uptime: %s\nYou have been connected for: %s",
+		formatDuration(time.Since(serverStartTime)), formatDuration(time.Since(c.connectedAt))))
+}
+
+func (c *Client) cmdTop() {
+	c.SendNotice(formatTopSenders(c.server.TopSenders(5)))
+}
+
+func formatTopSenders(top []NickCount) string {
+	if len(top) == 0 {
+		return "Top senders: none yet"
+	}
+	var b strings.Builder
+	b.WriteString("Top senders:")
+	for i, nc := range top {
+		fmt.Fprintf(&b, "\n%d. %s (%d)", i+1, nc.Nick, nc.Count)
+	}
+	return b.String()
+}
+
+func (c *Client) cmdTimezone(name string) {
+	if name == "" {
+		c.mu.Lock()
+		current := c.tz.String()
+		c.mu.Unlock()
+		c.SendNotice(fmt.Sprintf("Timezone: %s (usage: /timezone <IANA name>)", current))
+		return
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		c.SendNotice(fmt.Sprintf("Unknown timezone %q", name))
+		return
+	}
+	c.mu.Lock()
+	c.tz = loc
+	c.mu.Unlock()
+	c.SendNotice(fmt.Sprintf("Timezone set to %s", loc))
+}
+
+func (c *Client) cmdTime(arg string) {
+	c.mu.Lock()
+	switch arg {
+	case "12":
+		c.use12Hour = true
+	case "24":
+		c.use12Hour = false
+	case "":
+	default:
+		c.mu.Unlock()
+		c.SendNotice("Usage: /time [12|24]")
+		return
+	}
+	use12Hour := c.use12Hour
+	c.mu.Unlock()
+
+	if use12Hour {
+		c.SendNotice("Time format: 12-hour")
+	} else {
+		c.SendNotice("Time format: 24-hour")
+	}
+}
+
+func (c *Client) cmdShutdown(message string) {
+	if !c.requireAdmin() {
+		return
+	}
+	if message == "" {
+		message = "restart"
+	}
+	logAt(severityNotice, "audit: shutdown requested by %s (%s): %s", c.Nick(), c.ip, message)
+	requestShutdown(fmt.Sprintf("%s, requested by %s", message, c.Nick()))
+}
+
+// cmdReply sends text as a reply to an earlier message.
+func (c *Client) cmdReply(args string) {
+	idArg, text, _ := strings.Cut(args, " ")
+	text = strings.TrimSpace(text)
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil || text == "" {
+		c.SendNotice("Usage: /reply <messageID> <text>")
+		return
+	}
+	if _, ok := c.server.MessageByID(id); !ok {
+		c.SendNotice(fmt.Sprintf("No message with ID %d", id))
+		return
+	}
+	c.sendMessage(text, id)
+}
+
+// cmdRename lets an admin change another user's nickname.
+func (c *Client) cmdRename(args string) {
+	if !c.requireAdmin() {
+		return
+	}
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		c.SendNotice("Usage: /rename <oldnick> <newnick>")
+		return
+	}
+	oldNick, newNick := fields[0], norm.NFC.String(fields[1])
+	target := c.server.FindClient(oldNick)
+	if target == nil {
+		c.SendNotice(fmt.Sprintf("No user named %s", oldNick))
+		return
+	}
+	if err := validateNick(newNick); err != nil {
+		c.SendNotice(fmt.Sprintf("Cannot rename: %v", err))
+		return
+	}
+	if other := c.server.FindClient(newNick); other != nil && other != target {
+		c.SendNotice(fmt.Sprintf("Nickname %s is already in use", newNick))
+		return
+	}
+
+	target.mu.Lock()
+	oldNick = target.nickname
+	target.nickname = newNick
+	target.mu.Unlock()
+
+	logAt(severityNotice, "audit: rename %s -> %s by %s (%s)", oldNick, newNick, c.Nick(), c.ip)
+	c.server.AppendSystemMessage(fmt.Sprintf("%s has been renamed to %s", oldNick, newNick))
+	target.Notify()
+}
+
+func (c *Client) cmdInfo() {
+	c.mu.Lock()
+	nick, color, width, height, sent := c.nickname, c.color, c.width, c.height, c.sentCount
+	latency := c.renderStats
+	c.mu.Unlock()
+
+	ip := maskIP(c.ip)
+	if c.IsAdmin() {
+		ip = c.ip
+	}
+	c.SendNotice(fmt.Sprintf("Nickname: %s\nColor: \x1b[%dm%d\x1b[0m\nConnected: %s\nTerminal: %dx%d\nIP: %s\nMessages sent: %d\nAdmin: %t\nRender: %s",
+		nick, color, color, formatDuration(time.Since(c.connectedAt)), width, height, ip, sent, c.IsAdmin(), latency))
+}
+
+// maskIP hides the host part of an address for display to non-admins,
+// e.g. 192.168.1.20 becomes 192.168.*.*.
+func maskIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "*"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.*.*", v4[0], v4[1])
+	}
+	return fmt.Sprintf("%x:%x:*", uint16(ip[0])<<8|uint16(ip[1]), uint16(ip[2])<<8|uint16(ip[3]))
+}
+
+func (c *Client) cmdWhois(nick string) {
+	if !c.requireAdmin() {
+		return
+	}
+	if nick == "" {
+		c.SendNotice("Usage: /whois <nick>")
+		return
+	}
+	target := c.server.FindClient(nick)
+	if target == nil {
+		c.SendNotice(fmt.Sprintf("No user named %s", nick))
+		return
+	}
+	cert := "none"
+	if target.cert != nil {
+		cert = target.cert.String()
+	}
+	c.SendNotice(fmt.Sprintf("Nickname: %s\nIP: %s\nConnected: %s\nAdmin: %t\nCertificate: %s\nAgent forwarding requested: %t\nRender latency: %s",
+		target.Nick(), target.ip, formatDuration(time.Since(target.connectedAt)), target.IsAdmin(), cert, target.hasAgentForwarding, target.RenderLatency().Detail()))
+}
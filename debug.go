@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// debugSnapshot is the JSON document written by /debug.
+type debugSnapshot struct {
+	Time             time.Time `json:"time"`
+	Uptime           string    `json:"uptime"`
+	Messages         int       `json:"messages"`
+	Clients          int       `json:"clients"`
+	Nicks            []string  `json:"nicks"`
+	BannedIPs        int       `json:"banned_ips"`
+	BannedKeys       int       `json:"banned_keys"`
+	RateLimiterIPs   int       `json:"rate_limiter_ips"`
+	Goroutines       int       `json:"goroutines"`
+	HeapAllocBytes   uint64    `json:"heap_alloc_bytes"`
+	HeapObjects      uint64    `json:"heap_objects"`
+	SysBytes         uint64    `json:"sys_bytes"`
+	NumGC            uint32    `json:"num_gc"`
+	RecentErrors     []string  `json:"recent_errors"`
+	ThrottledConns   uint64    `json:"throttled_connections"`
+	InvalidUTF8Bytes uint64    `json:"invalid_utf8_bytes"`
+}
+
+func (st *ServerState) debugSnapshot() debugSnapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	clients := st.Chat.clientSnapshot()
+	nicks := make([]string, 0, len(clients))
+	for _, cl := range clients {
+		nicks = append(nicks, cl.Nick())
+	}
+	bannedIPs, bannedKeys := st.Bans.Count()
+
+	return debugSnapshot{
+		Time:             now(),
+		Uptime:           formatDuration(time.Since(serverStartTime)),
+		Messages:         len(st.Chat.Messages()),
+		Clients:          len(clients),
+		Nicks:            nicks,
+		BannedIPs:        bannedIPs,
+		BannedKeys:       bannedKeys,
+		RateLimiterIPs:   st.RateLimiter.CurrentEntryCount(),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapAllocBytes:   mem.HeapAlloc,
+		HeapObjects:      mem.HeapObjects,
+		SysBytes:         mem.Sys,
+		NumGC:            mem.NumGC,
+		RecentErrors:     lastErrors(),
+		ThrottledConns:   st.Throttle.RejectedCount(),
+		InvalidUTF8Bytes: invalidUTF8Bytes.Load(),
+	}
+}
+
+// cmdDebug writes a JSON snapshot of the server's internal state straight to
+// the admin's terminal, bypassing the message list, and holds rendering for
+// saveHold so it can be read or copied, like /save.
+func (c *Client) cmdDebug() {
+	if !c.requireAdmin() {
+		return
+	}
+	data, err := json.MarshalIndent(c.state.debugSnapshot(), "", "  ")
+	if err != nil {
+		c.SendNotice("Failed to encode debug snapshot: " + err.Error())
+		return
+	}
+	text := strings.ReplaceAll(string(data), "\n", "\r\n") + "\r\n"
+
+	if err := c.writeHeldText(text); err != nil {
+		c.Close()
+	}
+}
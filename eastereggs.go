@@ -0,0 +1,87 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var easterEggFile = flag.String("easter-egg-file", "", "JSON file with easter egg responses (uses the built-in set if empty or missing)")
+
+//go:embed eastereggs.json
+var defaultEasterEggs []byte
+
+// EasterEgg is a canned server reply to messages matching Pattern.
+// MatchMode is one of "contains" (the default), "prefix" or "regexp".
+// Messages containing Exclude, if set, never match.
+type EasterEgg struct {
+	Pattern   string `json:"pattern"`
+	Response  string `json:"response"`
+	MatchMode string `json:"match_mode"`
+	Exclude   string `json:"exclude,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// easterEggs is loaded once in main before the server starts.
+var easterEggs []EasterEgg
+
+func (e *EasterEgg) Match(text string) bool {
+	if e.Exclude != "" && strings.Contains(text, e.Exclude) {
+		return false
+	}
+	switch e.MatchMode {
+	case "prefix":
+		return strings.HasPrefix(text, e.Pattern)
+	case "regexp":
+		return e.re.MatchString(text)
+	default:
+		return strings.Contains(text, e.Pattern)
+	}
+}
+
+// parseEasterEggs decodes and validates an easter egg list, compiling
+// regexp patterns up front.
+func parseEasterEggs(data []byte) ([]EasterEgg, error) {
+	var eggs []EasterEgg
+	if err := json.Unmarshal(data, &eggs); err != nil {
+		return nil, err
+	}
+	for i := range eggs {
+		egg := &eggs[i]
+		switch egg.MatchMode {
+		case "", "contains", "prefix":
+		case "regexp":
+			re, err := regexp.Compile(egg.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("easter egg %d: %w", i, err)
+			}
+			egg.re = re
+		default:
+			return nil, fmt.Errorf("easter egg %d: unknown match_mode %q", i, egg.MatchMode)
+		}
+	}
+	return eggs, nil
+}
+
+// loadEasterEggs reads path, falling back to the embedded defaults when
+// path is empty or does not exist.
+func loadEasterEggs(path string) ([]EasterEgg, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return parseEasterEggs(data)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		log.Printf("easter egg file %s not found, using built-in set", path)
+	}
+	return parseEasterEggs(defaultEasterEggs)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var allowSave = flag.Bool("allow-save", false, "enable /save, which pauses the screen and dumps recent messages as plain text")
+
+// saveHold is how long rendering stays paused after /save so the plain text
+// can be read, copied or captured before the screen is redrawn.
+const saveHold = 10 * time.Second
+
+// ansiPattern matches CSI sequences (colors, cursor movement) and OSC
+// sequences (e.g. hyperlinks) terminated by BEL or ST.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// stripANSI removes ANSI escape sequences from s.
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// formatPlainMessage renders msg as a single "TIMESTAMP NICK: TEXT" line
+// without any escape codes.
+func formatPlainMessage(msg Message) string {
+	text := strings.ReplaceAll(msg.Text, "\n", " ")
+	if msg.ReplyTo != 0 {
+		text = fmt.Sprintf("[re #%d] %s", msg.ReplyTo, text)
+	}
+	return stripANSI(fmt.Sprintf("%s %s: %s", msg.Time.Format(time.RFC3339), msg.Nick, text))
+}
+
+// lastMessages returns at most n of the newest messages.
+func lastMessages(msgs []Message, n int) []Message {
+	if n < len(msgs) {
+		return msgs[len(msgs)-n:]
+	}
+	return msgs
+}
+
+// writePlainHistory writes msgs to the client's session as plain text on a
+// cleared screen, see writeHeldText.
+func (c *Client) writePlainHistory(msgs []Message) error {
+	return c.writeHeldText(plainHistory(msgs))
+}
+
+// writeHeldText clears the screen and writes text to the client's session,
+// see writeHeld.
+func (c *Client) writeHeldText(text string) error {
+	return c.writeHeld("\x1b[2J\x1b[H" + text)
+}
+
+// writeHeld writes data to the client's session, bypassing the render
+// pipeline, then holds off rendering for saveHold so the text is not
+// immediately overdrawn. The render lock is held so the text is not
+// interleaved with a screen update.
+func (c *Client) writeHeld(data string) error {
+	c.renderMu.Lock()
+	_, err := c.session.Write([]byte(data))
+	c.holdRenderUntil = now().Add(saveHold)
+	c.renderPaused = true // clear the screen when rendering resumes
+	c.renderMu.Unlock()
+	if err == nil {
+		time.AfterFunc(saveHold, c.Notify)
+	}
+	return err
+}
+
+// plainHistory formats msgs one per line, with CRLF line endings for raw
+// terminals.
+func plainHistory(msgs []Message) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		b.WriteString(formatPlainMessage(msg))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+func (c *Client) cmdExport(arg string) {
+	if !c.requireAdmin() {
+		return
+	}
+	n := 500
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v <= 0 {
+			c.SendNotice("Usage: /export [n]")
+			return
+		}
+		n = v
+	}
+	if err := c.writePlainHistory(lastMessages(c.server.Messages(), n)); err != nil {
+		c.Close()
+	}
+}
+
+// cmdSave writes the last n messages (default 200) to the session as plain
+// text, e.g. for `ssh host | grep something`, then holds off rendering for
+// saveHold. The text itself contains no escape codes; the screen is cleared
+// and redrawn when the hold ends.
+func (c *Client) cmdSave(arg string) {
+	if !*allowSave {
+		c.SendNotice("/save is disabled on this server.")
+		return
+	}
+	n := 200
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v <= 0 {
+			c.SendNotice("Usage: /save [n]")
+			return
+		}
+		n = v
+	}
+	// No screen clear: the text is kept free of escape codes for pipes.
+	if err := c.writeHeld("\r\n" + plainHistory(lastMessages(c.server.Messages(), n))); err != nil {
+		c.Close()
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// The "export" subsystem streams history without a terminal:
+//
+//	echo 'after=2024-01-02T15:04:05Z&limit=100&format=json' |
+//		ssh -s -p 2222 user@host export > messages.json
+//
+// The first line of input is a query string; every parameter is optional.
+// format=text (the default) writes formatPlainMessage lines, format=json
+// writes one JSON object per line. IP addresses are included for admins
+// only.
+
+// defaultExportLimit is the number of messages exported when the query has
+// no limit.
+const defaultExportLimit = 500
+
+// exportQuery is the parsed first line of an export session.
+type exportQuery struct {
+	after  time.Time
+	limit  int
+	format string
+}
+
+func parseExportQuery(line string) (exportQuery, error) {
+	q := exportQuery{limit: defaultExportLimit, format: "text"}
+	values, err := url.ParseQuery(strings.TrimSpace(line))
+	if err != nil {
+		return q, err
+	}
+	if v := values.Get("after"); v != "" {
+		if q.after, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("after: %w", err)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit <= 0 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	if v := values.Get("format"); v != "" {
+		if v != "json" && v != "text" {
+			return q, fmt.Errorf("format must be json or text")
+		}
+		q.format = v
+	}
+	return q, nil
+}
+
+// exportedMessage is the JSON form of a Message.
+type exportedMessage struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Nick    string    `json:"nick"`
+	Text    string    `json:"text"`
+	ReplyTo uint64    `json:"reply_to,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+}
+
+// writeExport writes the messages matching q to w.
+func writeExport(w io.Writer, msgs []Message, q exportQuery, includeIP bool) error {
+	var matched []Message
+	for _, msg := range msgs {
+		if msg.Time.After(q.after) {
+			matched = append(matched, msg)
+		}
+	}
+	matched = lastMessages(matched, q.limit)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, msg := range matched {
+		if q.format == "json" {
+			out := exportedMessage{ID: msg.ID, Time: msg.Time, Nick: msg.Nick, Text: msg.Text, ReplyTo: msg.ReplyTo}
+			if includeIP {
+				out.IP = msg.IP
+			}
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintln(bw, formatPlainMessage(msg)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// handleExportSubsystem serves one export query and exits.
+func (st *ServerState) handleExportSubsystem(s ssh.Session) {
+	defer logPanic()
+	if !finishNegotiation(s) {
+		return
+	}
+	ip := remoteIP(s)
+	logConnectionAttempt(s, ip)
+	fingerprint := ""
+	if pubKey := s.PublicKey(); pubKey != nil {
+		fingerprint = gossh.FingerprintSHA256(pubKey)
+	}
+	if !st.Throttle.Allow() {
+		fmt.Fprintln(s.Stderr(), "Server busy, try again shortly.")
+		_ = s.Exit(1)
+		return
+	}
+	if st.Bans.IsBanned(ip) || st.Bans.IsFingerprintBanned(fingerprint) {
+		fmt.Fprintln(s.Stderr(), "You are banned.")
+		_ = s.Exit(1)
+		return
+	}
+	if !st.RateLimiter.CheckAndRecord(ip) {
+		st.banWithReason(ip, "too many connections", "server")
+		fmt.Fprintln(s.Stderr(), "Your IP is banned for creating too many connections.")
+		_ = s.Exit(1)
+		return
+	}
+
+	line, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil && err != io.EOF {
+		_ = s.Exit(1)
+		return
+	}
+	q, err := parseExportQuery(line)
+	if err != nil {
+		fmt.Fprintf(s.Stderr(), "Invalid export query: %v\n", err)
+		_ = s.Exit(2)
+		return
+	}
+
+	admin := adminConfig.CheckIdentity(ip, fingerprint)
+	log.Printf("export ip=%s user=%q after=%s limit=%d format=%s admin=%t", ip, s.User(), q.after.Format(time.RFC3339), q.limit, q.format, admin)
+	if err := writeExport(s, st.Chat.Messages(), q, admin); err != nil {
+		_ = s.Exit(1)
+		return
+	}
+	_ = s.Exit(0)
+}
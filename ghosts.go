@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ghostProbeTimeout is how long /kick-ghost waits for each probe.
+const ghostProbeTimeout = 2 * time.Second
+
+// probe reports whether c's session still accepts writes. It takes renderMu
+// so that a client stuck in a blocked render write also fails the probe.
+func (c *Client) probe(timeout time.Duration) bool {
+	result := make(chan error, 1)
+	go func() {
+		c.renderMu.Lock()
+		defer c.renderMu.Unlock()
+		_, err := c.session.Write(nil)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// FindGhosts returns the clients whose session write fails or does not
+// return within timeout. All clients are probed concurrently.
+func (cs *ChatServer) FindGhosts(timeout time.Duration) []*Client {
+	clients := cs.clientSnapshot()
+	var (
+		mu     sync.Mutex
+		ghosts []*Client
+		wg     sync.WaitGroup
+	)
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !c.probe(timeout) {
+				mu.Lock()
+				ghosts = append(ghosts, c)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return ghosts
+}
+
+func (c *Client) cmdKickGhost() {
+	if !c.requireAdmin() {
+		return
+	}
+	ghosts := c.server.FindGhosts(ghostProbeTimeout)
+	for _, g := range ghosts {
+		logAt(severityNotice, "audit: kick-ghost %s (%s) by %s", g.Nick(), g.ip, c.Nick())
+		// Closing the session first fails the ghost's stuck write, which
+		// releases renderMu; Close then finds the render loop unblocked.
+		go func() {
+			_ = g.session.Close()
+			g.Close()
+		}()
+	}
+	c.SendNotice(fmt.Sprintf("Closed %d ghost connection(s).", len(ghosts)))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// The "chat" subsystem lets scripts and bots take part without a terminal:
+//
+//	ssh -s -p 2222 bot@host chat
+//
+// Each newline-terminated line read from the session is sent as a message
+// (or run as a command), and every new message is written back as a plain
+// "TIMESTAMP NICK: TEXT" line with no escape codes.
+
+// handleChatSubsystem serves a headless client. It applies the same ban,
+// rate limit and nickname rules as the interactive handler.
+func (st *ServerState) handleChatSubsystem(s ssh.Session) {
+	defer logPanic()
+	if !finishNegotiation(s) {
+		return
+	}
+	ip := remoteIP(s)
+	logConnectionAttempt(s, ip)
+	if !st.Throttle.Allow() {
+		fmt.Fprintln(s, "Server busy, try again shortly.")
+		_ = s.Exit(1)
+		return
+	}
+	fingerprint := ""
+	if pubKey := s.PublicKey(); pubKey != nil {
+		fingerprint = gossh.FingerprintSHA256(pubKey)
+	}
+
+	if st.Bans.IsBanned(ip) || st.Bans.IsFingerprintBanned(fingerprint) {
+		fmt.Fprintln(s, "You are banned.")
+		_ = s.Exit(1)
+		return
+	}
+	if !st.RateLimiter.CheckAndRecord(ip) {
+		st.banWithReason(ip, "too many connections", "server")
+		fmt.Fprintln(s, "Your IP is banned for creating too many connections.")
+		_ = s.Exit(1)
+		return
+	}
+
+	nickname, reservedNick := st.chooseNick(s.User())
+	client := NewClient(st.Chat, s, nickname, 0, 0, ip, *notifyBuf)
+	client.plain = true
+	client.state = st
+	client.plainLastID = st.Chat.LastMessageID()
+	client.plainLastNotice = now()
+	client.cert = certInfoFromKey(s.PublicKey())
+	client.pubKeyFingerprint = fingerprint
+	log.Printf("headless session ip=%s nick=%s", ip, nickname)
+
+	st.Chat.AddClient(client)
+	defer func() {
+		st.Chat.RemoveClient(client)
+		client.Close()
+		st.Chat.AnnounceLeave(client.Nick())
+	}()
+
+	st.Chat.AnnounceJoin(nickname)
+	if reservedNick != "" {
+		client.SendNotice(fmt.Sprintf("Nickname '%s' is reserved.", reservedNick))
+	}
+	client.Start(bufio.NewReader(s), s.Context())
+	client.Wait()
+}
+
+// plainInputLoop reads newline-terminated lines for a headless client and
+// hands each one to handleEnter as if it had been typed.
+func (c *Client) plainInputLoop(reader *bufio.Reader) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		c.mu.Lock()
+		c.inputBuffer = append(c.inputBuffer[:0], []rune(line)...)
+		c.mu.Unlock()
+		c.handleEnter()
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+	}
+	c.Close()
+}
+
+// unseenMessages returns the messages and notices that have not been
+// written yet and marks them as written. It is used by the line-oriented
+// views (headless and accessible clients); the caller holds renderMu.
+func (c *Client) unseenMessages() []Message {
+	var pending []Message
+	for _, msg := range c.server.Messages() {
+		if msg.ID > c.plainLastID {
+			pending = append(pending, msg)
+		}
+	}
+	if len(pending) > 0 {
+		c.plainLastID = pending[len(pending)-1].ID
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var notices []Message
+	for _, n := range c.notices {
+		if n.Time.After(c.plainLastNotice) {
+			notices = append(notices, n)
+		}
+	}
+	if len(notices) > 0 {
+		c.plainLastNotice = notices[len(notices)-1].Time
+	}
+	return mergeMessages(filterBlocked(pending, c.blocked), notices)
+}
+
+// renderPlain writes the messages and notices the headless client has not
+// seen yet. The caller holds renderMu.
+func (c *Client) renderPlain() error {
+	var b strings.Builder
+	for _, msg := range c.unseenMessages() {
+		b.WriteString(formatPlainMessage(msg))
+		b.WriteByte('\n')
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	return c.writeFrame([]byte(b.String()))
+}
+
+// rejectSFTP answers sftp subsystem requests, usually from a client that
+// assumed an SSH server on this port also serves files.
+func rejectSFTP(s ssh.Session) {
+	finishNegotiation(s)
+	log.Printf("rejected sftp subsystem ip=%s user=%q", remoteIP(s), s.User())
+	fmt.Fprintln(s.Stderr(), "This server is a chat server, not an SFTP server. Connect normally with: ssh <user>@<host>")
+	_ = s.Exit(1)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+)
+
+var (
+	honeypotMode = flag.Bool("honeypot", false, "admit banned IPs into an isolated fake chat instead of rejecting them")
+	honeypotLog  = flag.String("honeypot-log", "honeypot.log", "file that honeypot sessions are logged to")
+)
+
+// honeypotLogger records everything banned actors do in the honeypot.
+var honeypotLogger = log.New(os.Stderr, "honeypot: ", log.LstdFlags)
+
+// openHoneypotLog points honeypotLogger at path.
+func openHoneypotLog(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	honeypotLogger.SetOutput(tzLogWriter{f})
+	honeypotLogger.SetFlags(0)
+	return nil
+}
+
+var (
+	honeypotNicks = []string{"minsu", "jay", "devops_kim", "hana", "tux", "guest-17", "sora"}
+	honeypotLines = []string{
+		"ㅋㅋㅋㅋ",
+		"anyone here using k8s 1.30 yet?",
+		"brb coffee",
+		"lol",
+		"that's what I said yesterday",
+		"who broke prod again",
+		"오늘 배포 언제 해요?",
+		"nice",
+		"hmm not sure about that",
+		"+1",
+		"did you try turning it off and on again",
+		"ㅇㅇ",
+	}
+)
+
+// HoneypotRoom is a ChatRoom that is never connected to the real chat. It
+// echoes the banned client's own messages back to it, logs them, and answers
+// with canned chatter so that the session looks alive.
+type HoneypotRoom struct {
+	mu       sync.Mutex
+	messages []Message
+	clients  map[*Client]struct{}
+	lastID   uint64
+}
+
+var _ ChatRoom = (*HoneypotRoom)(nil)
+
+func NewHoneypotRoom() *HoneypotRoom {
+	return &HoneypotRoom{clients: make(map[*Client]struct{})}
+}
+
+func (h *HoneypotRoom) AppendMessage(msg Message) {
+	h.mu.Lock()
+	h.lastID++
+	msg.ID = h.lastID
+	h.messages = append(h.messages, msg)
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.Notify()
+	}
+	if msg.Type == MsgTypeUser && msg.IP != "" {
+		honeypotLogger.Printf("[%s@%s] %q", msg.Nick, msg.IP, msg.Text)
+		h.scheduleFakeReply()
+	}
+}
+
+// scheduleFakeReply posts a random canned line after a human-looking delay.
+func (h *HoneypotRoom) scheduleFakeReply() {
+	if rand.Intn(3) == 0 {
+		return
+	}
+	delay := time.Duration(1500+rand.Intn(4000)) * time.Millisecond
+	time.AfterFunc(delay, func() {
+		h.AppendMessage(Message{
+			Type:  MsgTypeUser,
+			Time:  now(),
+			Nick:  honeypotNicks[rand.Intn(len(honeypotNicks))],
+			Text:  honeypotLines[rand.Intn(len(honeypotLines))],
+			Color: colors[rand.Intn(len(colors))],
+		})
+	})
+}
+
+func (h *HoneypotRoom) AppendSystemMessage(text string) {
+	h.AppendServerMessage(MsgTypeSystem, text)
+}
+
+func (h *HoneypotRoom) AppendServerMessage(typ MessageType, text string) {
+	h.AppendMessage(Message{Type: typ, Time: now(), Nick: "server", Text: text, Color: typ.Color(), IsSystem: true})
+}
+
+func (h *HoneypotRoom) Messages() []Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Message(nil), h.messages...)
+}
+
+func (h *HoneypotRoom) MessageByID(id uint64) (Message, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, msg := range h.messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+func (h *HoneypotRoom) LastMessageID() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// ClientCount pretends the room is busy.
+func (h *HoneypotRoom) ClientCount() int {
+	return len(honeypotNicks)
+}
+
+func (h *HoneypotRoom) UsedColors() []int            { return nil }
+func (h *HoneypotRoom) TopSenders(n int) []NickCount { return nil }
+func (h *HoneypotRoom) DisconnectByIP(ip string) int { return 0 }
+func (h *HoneypotRoom) FindClient(string) *Client    { return nil }
+func (h *HoneypotRoom) AddReport(r Report) Report    { return r }
+func (h *HoneypotRoom) Reports(bool) []Report        { return nil }
+func (h *HoneypotRoom) DismissReport(uint64) bool    { return false }
+func (h *HoneypotRoom) BroadcastToAdmins(string)     {}
+func (h *HoneypotRoom) SlowMode() time.Duration      { return 0 }
+func (h *HoneypotRoom) SetSlowMode(time.Duration)    {}
+func (h *HoneypotRoom) LastSeen(string) (string, time.Time, bool) {
+	return "", time.Time{}, false
+}
+func (h *HoneypotRoom) FindGhosts(time.Duration) []*Client { return nil }
+
+func (h *HoneypotRoom) AddClient(c *Client) {
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *HoneypotRoom) RemoveClient(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// serveHoneypot runs a banned client's session in its own HoneypotRoom.
+func (st *ServerState) serveHoneypot(s ssh.Session, ip string, ptyReq ssh.Pty, winCh <-chan ssh.Window, reader *bufio.Reader) {
+	nickname := truncateNick(strings.TrimSpace(s.User()))
+	if nickname == "" || isReservedNick(nickname) {
+		nickname = st.generateGuestNickname()
+	}
+	honeypotLogger.Printf("session opened ip=%s user=%q nick=%s", ip, s.User(), nickname)
+	defer honeypotLogger.Printf("session closed ip=%s nick=%s", ip, nickname)
+
+	room := NewHoneypotRoom()
+	room.AppendSystemMessage("Welcome to the SSH chat! Use ↑/↓ to scroll and Enter to send messages.")
+
+	client := NewClient(room, s, nickname, ptyReq.Window.Width, ptyReq.Window.Height, ip, *notifyBuf)
+	client.caps = detectTermCapabilities(s, ptyReq.Term)
+	client.envCaps = client.caps
+	client.honeypot = true
+	room.AddClient(client)
+	defer func() {
+		room.RemoveClient(client)
+		client.Close()
+	}()
+
+	fmt.Fprint(s, "\x1b[2J\x1b[H")
+	room.AppendServerMessage(MsgTypeJoin, fmt.Sprintf("%s joined the chat", nickname))
+
+	go client.MonitorWindow(winCh)
+	client.Start(reader, s.Context())
+	client.Wait()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// waitTimeout bounds every wait for output in the integration test.
+const waitTimeout = 5 * time.Second
+
+// newTestSigner generates an ed25519 key pair.
+func newTestSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startTestServer serves st on a random local port with publickey
+// authentication for keys, and returns the address and host key. Cleanup
+// waits for the session handlers to return, since they still read
+// package-level settings.
+func startTestServer(t *testing.T, st *ServerState, keys ...gossh.Signer) (string, gossh.PublicKey) {
+	t.Helper()
+	auth := &AuthConfig{mode: "publickey", keys: make(map[string]struct{})}
+	for _, key := range keys {
+		auth.keys[string(key.PublicKey().Marshal())] = struct{}{}
+	}
+	hostKey := newTestSigner(t)
+	srv := newSSHServer(":0", st)
+	auth.Configure(srv, st.Chat)
+	srv.AddHostKey(hostKey)
+
+	var sessions sync.WaitGroup
+	handler := srv.Handler
+	srv.Handler = func(s ssh.Session) {
+		sessions.Add(1)
+		defer sessions.Done()
+		handler(s)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		sessions.Wait()
+	})
+	return ln.Addr().String(), hostKey.PublicKey()
+}
+
+// testTerminal is one interactive SSH session to the test server.
+type testTerminal struct {
+	t       *testing.T
+	session *gossh.Session
+	stdin   io.WriteCloser
+
+	mu     sync.Mutex
+	output strings.Builder
+	eof    chan struct{}
+}
+
+func dialTerminal(t *testing.T, addr string, hostKey gossh.PublicKey, user string, key gossh.Signer) *testTerminal {
+	t.Helper()
+	client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(key)},
+		HostKeyCallback: gossh.FixedHostKey(hostKey),
+		Timeout:         waitTimeout,
+	})
+	if err != nil {
+		t.Fatalf("dial as %q: %v", user, err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestPty("xterm", 24, 80, gossh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+
+	term := &testTerminal{t: t, session: session, stdin: stdin, eof: make(chan struct{})}
+	go func() {
+		defer close(term.eof)
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			term.mu.Lock()
+			term.output.Write(buf[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return term
+}
+
+// waitFor fails the test unless want shows up in the output in time.
+func (tt *testTerminal) waitFor(want string) {
+	tt.t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		tt.mu.Lock()
+		found := strings.Contains(tt.output.String(), want)
+		tt.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tt.t.Fatalf("timed out waiting for %q", want)
+}
+
+// send types line and presses Enter.
+func (tt *testTerminal) send(line string) {
+	tt.t.Helper()
+	if _, err := io.WriteString(tt.stdin, line+"\r"); err != nil {
+		tt.t.Fatalf("send %q: %v", line, err)
+	}
+}
+
+func TestServerLifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	adminKey := newTestSigner(t)
+	userKey := newTestSigner(t)
+
+	old := adminConfig.fingerprints
+	adminConfig.mu.Lock()
+	adminConfig.fingerprints = map[string]struct{}{gossh.FingerprintSHA256(adminKey.PublicKey()): {}}
+	adminConfig.mu.Unlock()
+	t.Cleanup(func() {
+		adminConfig.mu.Lock()
+		adminConfig.fingerprints = old
+		adminConfig.mu.Unlock()
+	})
+
+	st := NewServerState()
+	addr, hostKey := startTestServer(t, st, adminKey, userKey)
+
+	// A blank user name gets a guest nickname.
+	guest := dialTerminal(t, addr, hostKey, "", userKey)
+	guest.waitFor("guest-1 joined the chat")
+
+	admin := dialTerminal(t, addr, hostKey, "root-admin", adminKey)
+	admin.waitFor("root-admin joined the chat")
+	guest.waitFor("root-admin joined the chat")
+
+	// A message from one client reaches the other.
+	guest.send("hello from the guest")
+	admin.waitFor("hello from the guest")
+
+	// /ban is admin only.
+	guest.send("/ban 203.0.113.9")
+	guest.waitFor("Permission denied")
+	admin.send("/ban 203.0.113.9")
+	guest.waitFor("IP 203.0.113.9 banned by root-admin")
+	if !st.Bans.IsBanned("203.0.113.9") {
+		t.Error("203.0.113.9 is not banned after /ban")
+	}
+
+	// Graceful shutdown: the countdown reaches every client, then the
+	// sessions are closed.
+	shutdownCountdown(st.Chat, "test", 20*time.Millisecond)
+	guest.waitFor("서버 폭파 5초전 (test)")
+	guest.waitFor("0 초")
+	admin.waitFor("????????????")
+	st.Chat.Shutdown("test")
+	for _, term := range []*testTerminal{guest, admin} {
+		select {
+		case <-term.eof:
+		case <-time.After(waitTimeout):
+			t.Fatal("session still open after Shutdown")
+		}
+	}
+}
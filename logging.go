@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var useSyslog = flag.Bool("syslog", false, "also send chat messages and audit events to the local syslog daemon (facility LOCAL0); not available on Windows")
+
+// logSeverity selects the syslog priority of a log line. Lines are always
+// written to the standard logger too.
+type logSeverity int
+
+const (
+	severityInfo    logSeverity = iota // chat messages
+	severityNotice                     // admin actions
+	severityError                      // failures, see logError
+	severityWarning                    // bans
+	severityCrit                       // panics
+)
+
+// logAt writes a line to the standard logger and, with -syslog, to syslog at
+// the given severity.
+func logAt(sev logSeverity, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	log.Print(line)
+	writeSyslog(sev, line)
+}
+
+// recentErrorCount is how many logError lines /debug shows.
+const recentErrorCount = 5
+
+// recentErrors keeps the last recentErrorCount lines passed to logError.
+var recentErrors struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// logError logs a failure at error severity and remembers it for /debug.
+func logError(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	logAt(severityError, "%s", line)
+
+	recentErrors.mu.Lock()
+	recentErrors.lines = append(recentErrors.lines, now().Format(time.RFC3339)+" "+line)
+	if len(recentErrors.lines) > recentErrorCount {
+		recentErrors.lines = recentErrors.lines[len(recentErrors.lines)-recentErrorCount:]
+	}
+	recentErrors.mu.Unlock()
+}
+
+// lastErrors returns a copy of the remembered logError lines, oldest first.
+func lastErrors() []string {
+	recentErrors.mu.Lock()
+	defer recentErrors.mu.Unlock()
+	return append([]string(nil), recentErrors.lines...)
+}
+
+// logPanic is deferred at the top of session handlers so that a crash is
+// recorded in syslog before it takes the process down.
+func logPanic() {
+	if r := recover(); r != nil {
+		logAt(severityCrit, "panic: %v", r)
+		panic(r)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,64 +22,318 @@ import (
 	"unicode"
 
 	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/text/unicode/norm"
 )
 
+// MessageType categorizes a message; server messages are colored by type.
+type MessageType int
+
+const (
+	MsgTypeUser MessageType = iota
+	MsgTypeSystem
+	MsgTypeJoin
+	MsgTypeLeave
+	MsgTypeBan
+	MsgTypeAdmin
+	MsgTypeEasterEgg
+)
+
+// Color returns the nick color used for server messages of type t.
+func (t MessageType) Color() int {
+	switch t {
+	case MsgTypeJoin:
+		return systemColors.Join
+	case MsgTypeLeave:
+		return systemColors.Leave
+	case MsgTypeBan:
+		return systemColors.Ban
+	case MsgTypeAdmin:
+		return 33 // yellow
+	case MsgTypeEasterEgg:
+		return 36 // cyan
+	default:
+		return systemColors.System
+	}
+}
+
 type Message struct {
+	ID       uint64 // assigned by ChatServer.AppendMessage, starting at 1; 0 for private notices
+	Type     MessageType
 	Time     time.Time
 	Nick     string
 	Text     string
-	Color    int
+	Color    int // nick color fixed when the message is created; see formatMessage
 	IP       string
 	Mentions []string // List of mentioned usernames
+	IsSystem bool     // posted by the server; never scanned for mentions
+	ReplyTo  uint64   // ID of the message this one replies to (/reply), or 0
 }
 
 type ChatServer struct {
-	mu       sync.RWMutex
-	messages []Message
-	clients  map[*Client]struct{}
+	mu           sync.RWMutex
+	messages     []Message
+	clients      map[*Client]struct{}
+	sentMessages map[string]uint64 // nick -> messages sent since server start
+	msgCounter   atomic.Uint64     // last assigned Message.ID
+	reports      []Report          // moderation queue, see reports.go
+
+	pendingLeaves sync.Map // nick -> *time.Timer for a deferred leave announcement
+	lastSeen      sync.Map // lowercased nick -> lastSeen, recorded by RemoveClient
+	joinLeave     JoinLeaveRateLimiter
+
+	slowModeInterval atomic.Int64 // nanoseconds between messages per user, see slowmode.go
+
+	// shutting is set by Shutdown. Later messages (e.g. leaves from
+	// sessions being torn down) are stored but nobody is notified, since
+	// every client is about to close.
+	shutting bool
 }
 
-var (
-	globalChat   = NewChatServer()
-	guestCounter uint64
-	rateLimiter  = NewConnectionRateLimiter()
-)
+// ChatRoom is the interface a Client uses to talk to its chat server.
+// *ChatServer implements it; tests can substitute a recording fake.
+type ChatRoom interface {
+	AppendMessage(msg Message)
+	AppendSystemMessage(text string)
+	AppendServerMessage(typ MessageType, text string)
+	Messages() []Message
+	MessageByID(id uint64) (Message, bool)
+	LastMessageID() uint64
+	ClientCount() int
+	UsedColors() []int
+	TopSenders(n int) []NickCount
+	AddClient(c *Client)
+	RemoveClient(c *Client)
+	DisconnectByIP(ip string) int
+	FindClient(nick string) *Client
+	AddReport(r Report) Report
+	Reports(includeReviewed bool) []Report
+	DismissReport(id uint64) bool
+	BroadcastToAdmins(msg string)
+	SlowMode() time.Duration
+	SetSlowMode(d time.Duration)
+	LastSeen(nick string) (string, time.Time, bool)
+	FindGhosts(timeout time.Duration) []*Client
+}
+
+var _ ChatRoom = (*ChatServer)(nil)
+
+// NickCount is a leaderboard entry returned by TopSenders.
+type NickCount struct {
+	Nick  string
+	Count uint64
+}
+
+// serverStartTime is set once in main before the server starts listening.
+var serverStartTime time.Time
+
+// addrList is a flag.Value collecting listen addresses from repeated or
+// comma-separated -addr flags.
+type addrList []string
+
+func (a *addrList) String() string {
+	return strings.Join(*a, ",")
+}
+
+func (a *addrList) Set(value string) error {
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			*a = append(*a, addr)
+		}
+	}
+	return nil
+}
+
+var listenAddrs addrList
+
+func init() {
+	flag.Var(&listenAddrs, "addr", "listen address; may be repeated or comma-separated (default \":2222\")")
+}
+
+var maxBytesPerMin = flag.Int("max-bytes-per-min", 10000, "maximum message bytes a client may send per minute before being banned (0 disables)")
+
+var maxScroll = flag.Int("max-scroll", 500, "maximum number of lines a client can scroll back (0 for unlimited)")
+
+// topOfHistoryLine marks the oldest line a client can scroll to.
+const topOfHistoryLine = "\x1b[2m-- top of history --\x1b[0m"
+
+var notifyBuf = flag.Int("notify-buf", 16, "per-client buffer of pending screen updates; raise it for slow or large terminals")
+
+var serverVersion = flag.String("server-version", "SSH-2.0-sshttp-chat", "SSH version string advertised to clients instead of the library default")
 
 // BanManager keeps a set of banned IP addresses.
 type BanManager struct {
-	mu     sync.RWMutex
-	banned map[string]struct{}
+	mu           sync.RWMutex
+	banned       map[string]struct{}
+	expires      map[string]time.Time // end of temporary bans set by BanFor
+	fingerprints map[string]struct{}  // banned public key SHA256 fingerprints
+
+	// Hits and Misses count IsBanned results (banned vs. allowed).
+	Hits   atomic.Uint64
+	Misses atomic.Uint64
 }
 
 func NewBanManager() *BanManager {
-	return &BanManager{banned: make(map[string]struct{})}
+	return &BanManager{
+		banned:       make(map[string]struct{}),
+		expires:      make(map[string]time.Time),
+		fingerprints: make(map[string]struct{}),
+	}
 }
 
 func (b *BanManager) IsBanned(ip string) bool {
 	b.mu.RLock()
 	_, ok := b.banned[ip]
+	expiry, temporary := b.expires[ip]
 	b.mu.RUnlock()
+	if ok && temporary && !time.Now().Before(expiry) {
+		b.unbanExpired(ip)
+		ok = false
+	}
+	if ok {
+		b.Hits.Add(1)
+	} else {
+		b.Misses.Add(1)
+	}
 	return ok
 }
 
+// Count returns the number of banned IP addresses and key fingerprints.
+func (b *BanManager) Count() (ips, fingerprints int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.banned), len(b.fingerprints)
+}
+
 func (b *BanManager) Ban(ip string) {
 	b.mu.Lock()
 	b.banned[ip] = struct{}{}
+	delete(b.expires, ip) // a permanent ban replaces a temporary one
+	b.mu.Unlock()
+}
+
+// BanFor bans ip for d. It does not shorten an existing permanent ban.
+func (b *BanManager) BanFor(ip string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, banned := b.banned[ip]; banned {
+		if _, temporary := b.expires[ip]; !temporary {
+			return
+		}
+	}
+	b.banned[ip] = struct{}{}
+	b.expires[ip] = time.Now().Add(d)
+}
+
+// unbanExpired lifts the temporary ban on ip if it has run out.
+func (b *BanManager) unbanExpired(ip string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if expiry, ok := b.expires[ip]; ok && !time.Now().Before(expiry) {
+		delete(b.banned, ip)
+		delete(b.expires, ip)
+	}
+}
+
+// BanFingerprint bans a public key by its SHA256 fingerprint, so the key's
+// owner cannot get around an IP ban by reconnecting from elsewhere.
+func (b *BanManager) BanFingerprint(fp string) {
+	b.mu.Lock()
+	b.fingerprints[fp] = struct{}{}
 	b.mu.Unlock()
 }
 
-var banManager = NewBanManager()
+// IsFingerprintBanned reports whether the key with fingerprint fp is banned.
+func (b *BanManager) IsFingerprintBanned(fp string) bool {
+	if fp == "" {
+		return false
+	}
+	b.mu.RLock()
+	_, ok := b.fingerprints[fp]
+	b.mu.RUnlock()
+	return ok
+}
+
+// banWithReason bans ip, disconnects its sessions, writes an audit log line
+// and announces the ban in chat. actorNick is the nick that issued the ban,
+// or "server" for automatic bans. It returns the number of sessions closed.
+func (st *ServerState) banWithReason(ip, reason, actorNick string) int {
+	st.Bans.Ban(ip)
+	// Also ban the keys used from this IP. The fingerprints go to the log
+	// only; the chat announcement shows just the IP.
+	fingerprints := st.Chat.FingerprintsByIP(ip)
+	for _, fp := range fingerprints {
+		st.Bans.BanFingerprint(fp)
+	}
+	// Announce before disconnecting so the banned sessions see the reason.
+	st.Chat.AppendServerMessage(MsgTypeBan, fmt.Sprintf("IP %s banned by %s (%s).", ip, actorNick, reason))
+	disconnected := st.Chat.DisconnectByIP(ip)
+	logAt(severityWarning, "audit: ban ip=%s actor=%s reason=%q disconnected=%d fingerprints=%s", ip, actorNick, reason, disconnected, strings.Join(fingerprints, ","))
+	return disconnected
+}
+
+// connectionsPerMinute is how many connections one IP may open per minute
+// before ConnectionRateLimiter bans it.
+const connectionsPerMinute = 5
+
+// Per-client message limits per minute: admins are warned at
+// spamWarnMessages, and the sender is banned above spamLimitMessages.
+const (
+	spamWarnMessages  = 25
+	spamLimitMessages = 30
+)
 
 // ConnectionRateLimiter tracks connection attempts per IP.
 type ConnectionRateLimiter struct {
 	mu      sync.Mutex
 	entries map[string][]time.Time
+	now     func() time.Time // clock; replaced in tests
+
+	// OnNearLimit, if set, is called when ip makes the last connection
+	// allowed within the current minute.
+	OnNearLimit func(ip string)
+
+	// AllowedCount and DeniedCount count CheckAndRecord results.
+	AllowedCount atomic.Uint64
+	DeniedCount  atomic.Uint64
 }
 
 func NewConnectionRateLimiter() *ConnectionRateLimiter {
-	return &ConnectionRateLimiter{
+	rl := &ConnectionRateLimiter{
 		entries: make(map[string][]time.Time),
+		now:     time.Now,
 	}
+	go rl.cleanupLoop(5 * time.Minute)
+	return rl
+}
+
+// cleanupLoop periodically evicts IPs that have not connected within the
+// last minute so that entries does not grow without bound.
+func (rl *ConnectionRateLimiter) cleanupLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rl.cleanup()
+	}
+}
+
+func (rl *ConnectionRateLimiter) cleanup() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	oneMinuteAgo := rl.now().Add(-1 * time.Minute)
+	for ip, timestamps := range rl.entries {
+		if len(timestamps) == 0 || !timestamps[len(timestamps)-1].After(oneMinuteAgo) {
+			delete(rl.entries, ip)
+		}
+	}
+}
+
+// CurrentEntryCount returns the number of IPs currently tracked.
+func (rl *ConnectionRateLimiter) CurrentEntryCount() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return len(rl.entries)
 }
 
 // CheckAndRecord returns true if the connection should be allowed, false otherwise.
@@ -83,7 +341,7 @@ func (rl *ConnectionRateLimiter) CheckAndRecord(ip string) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	now := rl.now()
 	oneMinuteAgo := now.Add(-1 * time.Minute)
 
 	timestamps := rl.entries[ip]
@@ -95,25 +353,34 @@ func (rl *ConnectionRateLimiter) CheckAndRecord(ip string) bool {
 		}
 	}
 
-	if len(newTimestamps) >= 5 {
+	if len(newTimestamps) >= connectionsPerMinute {
+		rl.DeniedCount.Add(1)
 		return false
 	}
 
 	newTimestamps = append(newTimestamps, now)
 	rl.entries[ip] = newTimestamps
+	rl.AllowedCount.Add(1)
+	if len(newTimestamps) == connectionsPerMinute && rl.OnNearLimit != nil {
+		rl.OnNearLimit(ip)
+	}
 	return true
 }
 
 func NewChatServer() *ChatServer {
 	cs := &ChatServer{
-		clients: make(map[*Client]struct{}),
+		clients:      make(map[*Client]struct{}),
+		sentMessages: make(map[string]uint64),
 	}
 	welcome := Message{
-		Time:  time.Now(),
-		Nick:  "server",
-		Text:  "Welcome to the SSH chat! Use ↑/↓ to scroll and Enter to send messages.",
-		Color: 37,
-	}
+		Type:     MsgTypeSystem,
+		Time:     now(),
+		Nick:     "server",
+		Text:     "Welcome to the SSH chat! Use ↑/↓ to scroll and Enter to send messages.",
+		Color:    MsgTypeSystem.Color(),
+		IsSystem: true,
+	}
+	welcome.ID = cs.msgCounter.Add(1)
 	cs.messages = append(cs.messages, welcome)
 	cs.logMessage(welcome)
 	return cs
@@ -129,17 +396,26 @@ func (cs *ChatServer) RemoveClient(c *Client) {
 	cs.mu.Lock()
 	delete(cs.clients, c)
 	cs.mu.Unlock()
+	cs.recordSeen(c.Nick())
 }
 
 func (cs *ChatServer) AppendMessage(msg Message) {
-	// Detect mentions in the message
-	msg.Mentions = extractMentions(msg.Text)
+	// Detect mentions in the message. Server text may quote user input
+	// (easter egg responses, ban reasons) and must not ring anyone's bell.
+	if !msg.IsSystem {
+		msg.Mentions = extractMentions(msg.Text)
+	}
 
 	cs.mu.Lock()
+	// Assign the ID under the lock so that history stays ordered by ID.
+	msg.ID = cs.msgCounter.Add(1)
 	cs.messages = append(cs.messages, msg)
-	clients := make([]*Client, 0, len(cs.clients))
-	for c := range cs.clients {
-		clients = append(clients, c)
+	if msg.Type == MsgTypeUser {
+		cs.sentMessages[msg.Nick]++
+	}
+	var clients []*Client
+	if !cs.shutting {
+		clients = cs.clientSnapshotLocked()
 	}
 	cs.mu.Unlock()
 
@@ -147,44 +423,102 @@ func (cs *ChatServer) AppendMessage(msg Message) {
 
 	// Send notifications to all clients, with bell for mentioned users
 	for _, client := range clients {
+		if msg.Type == MsgTypeUser && client.hasBlocked(msg.Nick) {
+			continue // hidden from this client's view, see block.go
+		}
 		isMentioned := false
 		for _, mention := range msg.Mentions {
-			if strings.EqualFold(client.nickname, mention) {
+			if strings.EqualFold(client.Nick(), mention) {
 				isMentioned = true
 				break
 			}
 		}
+		if isMentioned && client.isBlockedBy(msg.Nick) {
+			isMentioned = false
+		}
+		client.markUnread()
 		client.NotifyWithBell(isMentioned)
 	}
 }
 
 func (cs *ChatServer) AppendSystemMessage(text string) {
+	cs.AppendServerMessage(MsgTypeSystem, text)
+}
+
+// AppendServerMessage appends a message from "server" colored by its type.
+func (cs *ChatServer) AppendServerMessage(typ MessageType, text string) {
 	cs.AppendMessage(Message{
-		Time:  time.Now(),
-		Nick:  "server",
-		Text:  text,
-		Color: 37,
+		Type:     typ,
+		Time:     now(),
+		Nick:     "server",
+		Text:     text,
+		Color:    typ.Color(),
+		IsSystem: true,
 	})
 }
 
-// DisconnectByIP closes all clients currently connected from the given IP.
-func (cs *ChatServer) DisconnectByIP(ip string) int {
+// clientSnapshot returns a copy of the connected clients. Anything that
+// does per-client work (notifying, rendering, closing, sending notices)
+// should iterate a snapshot rather than cs.clients: Close renders a final
+// frame, which calls back into cs, so it must not run under cs.mu.
+func (cs *ChatServer) clientSnapshot() []*Client {
 	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.clientSnapshotLocked()
+}
+
+// clientSnapshotLocked is clientSnapshot for callers already holding cs.mu.
+func (cs *ChatServer) clientSnapshotLocked() []*Client {
 	clients := make([]*Client, 0, len(cs.clients))
 	for c := range cs.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// DisconnectByIP closes all clients currently connected from the given IP.
+func (cs *ChatServer) DisconnectByIP(ip string) int {
+	var clients []*Client
+	for _, c := range cs.clientSnapshot() {
 		if c.ip == ip {
 			clients = append(clients, c)
 		}
 	}
-	cs.mu.RUnlock()
 	for _, c := range clients {
-		// Best-effort notify and close
-		_ = c.session.Exit(1)
+		// Close first so the final screen is flushed while the session is open
 		c.Close()
+		_ = c.session.Exit(1)
 	}
 	return len(clients)
 }
 
+// FingerprintsByIP returns the public key fingerprints of the clients
+// connected from ip that authenticated with a key.
+func (cs *ChatServer) FingerprintsByIP(ip string) []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	var fps []string
+	for c := range cs.clients {
+		if c.ip == ip && c.pubKeyFingerprint != "" && !slices.Contains(fps, c.pubKeyFingerprint) {
+			fps = append(fps, c.pubKeyFingerprint)
+		}
+	}
+	return fps
+}
+
+// FindClient returns the connected client with the given nick (compared
+// case-insensitively), or nil.
+func (cs *ChatServer) FindClient(nick string) *Client {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for c := range cs.clients {
+		if strings.EqualFold(c.Nick(), nick) {
+			return c
+		}
+	}
+	return nil
+}
+
 func (cs *ChatServer) Messages() []Message {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
@@ -193,6 +527,74 @@ func (cs *ChatServer) Messages() []Message {
 	return out
 }
 
+// TopSenders returns the n nicks with the most messages, most active first.
+func (cs *ChatServer) TopSenders(n int) []NickCount {
+	cs.mu.RLock()
+	out := make([]NickCount, 0, len(cs.sentMessages))
+	for nick, count := range cs.sentMessages {
+		out = append(out, NickCount{Nick: nick, Count: count})
+	}
+	cs.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Nick < out[j].Nick
+	})
+	if n >= 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// UsedColors returns the nick colors of the currently connected clients.
+func (cs *ChatServer) UsedColors() []int {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	used := make([]int, 0, len(cs.clients))
+	for c := range cs.clients {
+		c.mu.Lock()
+		used = append(used, c.color)
+		c.mu.Unlock()
+	}
+	return used
+}
+
+// MessageByID looks up a message in the history by its ID.
+func (cs *ChatServer) MessageByID(id uint64) (Message, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	i := sort.Search(len(cs.messages), func(i int) bool { return cs.messages[i].ID >= id })
+	if i < len(cs.messages) && cs.messages[i].ID == id {
+		return cs.messages[i], true
+	}
+	return Message{}, false
+}
+
+// WaitForRenders blocks until every client has consumed its pending update
+// notifications, or until timeout so that a stuck client cannot stall the
+// caller. It reports whether all clients caught up.
+func (cs *ChatServer) WaitForRenders(timeout time.Duration) bool {
+	clients := cs.clientSnapshot()
+	deadline := time.Now().Add(timeout)
+	for _, c := range clients {
+		for c.hasPendingUpdate() {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return true
+}
+
+// LastMessageID returns the ID of the most recent message, which is also the
+// total number of messages appended since the server started.
+func (cs *ChatServer) LastMessageID() uint64 {
+	return cs.msgCounter.Load()
+}
+
 func (cs *ChatServer) ClientCount() int {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
@@ -205,37 +607,105 @@ func (cs *ChatServer) logMessage(msg Message) {
 		sanitized = sanitized[:20]
 	}
 	if msg.IP != "" {
-		log.Printf("%s [%s@%s] %s", msg.Time.Format(time.RFC3339), msg.Nick, msg.IP, sanitized)
+		logAt(severityInfo, "%s [%s@%s] %s", msg.Time.Format(time.RFC3339), msg.Nick, msg.IP, sanitized)
 		return
 	}
-	log.Printf("%s [%s] %s", msg.Time.Format(time.RFC3339), msg.Nick, sanitized)
+	logAt(severityInfo, "%s [%s] %s", msg.Time.Format(time.RFC3339), msg.Nick, sanitized)
 }
 
 type Client struct {
 	session ssh.Session
-	server  *ChatServer
+	server  ChatRoom
 
 	mu                sync.Mutex
 	width             int
 	height            int
 	scrollOffset      int
+	tooSmall          bool // window below minTermWidth x minTermHeight
 	inputBuffer       []rune
 	messageTimestamps []time.Time
-
-	updateCh  chan struct{}
-	done      chan struct{}
-	closeOnce sync.Once
-	wg        sync.WaitGroup
-	nickname  string
-	color     int
-	ip        string
+	sentCount         int       // chat messages sent this session
+	messageSizes      []int     // byte length of each message in messageTimestamps
+	bytesThisMinute   uint64    // sum of messageSizes
+	notices           []Message // private server messages, visible only to this client
+
+	renderMu          sync.Mutex
+	renderPaused      bool           // terminal too small or /save; guarded by renderMu
+	holdRenderUntil   time.Time      // set by /save and /export; guarded by renderMu
+	writeFailCount    int            // consecutive failed render writes; guarded by renderMu
+	firstRender       bool           // capability probe not yet sent; guarded by renderMu
+	updateCh          chan time.Time // carries when the update was requested
+	done              chan struct{}
+	closeOnce         sync.Once
+	wg                sync.WaitGroup
+	nickname          string // guarded by mu; may change via /rename
+	color             int
+	ip                string
+	tz                *time.Location // timezone used to display message timestamps
+	use12Hour         bool
+	caps              TermCapabilities // guarded by mu once the client has started
+	envCaps           TermCapabilities // caps as detected from the environment
+	probeStatus       probeState       // capability probe progress; guarded by mu
+	probeSGR          string           // DECRQSS answer to the probe pixel; guarded by mu
+	cert              *CertInfo        // set if the client authenticated with a user certificate
+	pubKeyFingerprint string           // SHA256 fingerprint of the auth key, "" without one
+	honeypot          bool             // banned client served by serveHoneypot
+	state             *ServerState     // nil for honeypot clients
+
+	hasAgentForwarding bool // client requested SSH agent forwarding (never granted)
+
+	searchMode  bool   // Ctrl+F search bar is open, see search.go
+	searchQuery string // guarded by mu
+
+	unreadCount int // messages received while scrolled up; guarded by mu
+
+	lastChatAt time.Time // last message allowed by slow mode; guarded by mu
+
+	renderStats renderLatencyStats // see renderstats.go; guarded by mu
+
+	markdownEnabled bool // /format on|off; guarded by mu
+
+	blocked   map[string]struct{} // lowercased nicks this client blocked; guarded by mu
+	blockedBy map[string]struct{} // lowercased nicks that blocked this client; guarded by mu
+
+	accessibleMode bool   // line-by-line output, see accessible.go; guarded by mu
+	accessibleEcho []rune // input already echoed in accessible mode; guarded by renderMu
+
+	// Headless "chat" subsystem clients, see headless.go.
+	plain           bool
+	plainLastID     uint64    // newest message ID written (headless/accessible); guarded by renderMu
+	plainLastNotice time.Time // newest notice written (headless/accessible); guarded by mu
+
+	connectedAt time.Time
 }
 
 var colors = []int{
 	31, 32, 33, 34, 35, 36,
 }
 
-func NewClient(server *ChatServer, session ssh.Session, nickname string, width, height int, ip string) *Client {
+// pickColor returns a random nick color not in used, falling back to any
+// random color once every color is taken.
+func pickColor(used []int) int {
+	for i := 0; i < len(colors); i++ {
+		candidate := colors[rand.Intn(len(colors))]
+		if !slices.Contains(used, candidate) {
+			return candidate
+		}
+	}
+	for _, candidate := range colors {
+		if !slices.Contains(used, candidate) {
+			return candidate
+		}
+	}
+	return colors[rand.Intn(len(colors))]
+}
+
+// NewClient creates a client. notifyBuf is the capacity of the update
+// channel; notifications beyond it are dropped until the render loop catches up.
+func NewClient(server ChatRoom, session ssh.Session, nickname string, width, height int, ip string, notifyBuf int) *Client {
+	if notifyBuf < 1 {
+		notifyBuf = 1
+	}
 	if width <= 0 || width > 8192 {
 		width = 80
 	}
@@ -247,13 +717,18 @@ func NewClient(server *ChatServer, session ssh.Session, nickname string, width,
 		server:            server,
 		width:             width,
 		height:            height,
-		updateCh:          make(chan struct{}, 16),
+		tooSmall:          width < minTermWidth || height < minTermHeight,
+		updateCh:          make(chan time.Time, notifyBuf),
 		done:              make(chan struct{}),
 		nickname:          nickname,
-		color:             colors[rand.Intn(len(colors))],
+		color:             pickColor(server.UsedColors()),
 		inputBuffer:       make([]rune, 0, 128),
 		messageTimestamps: make([]time.Time, 0),
 		ip:                ip,
+		tz:                serverLocation, // -timezone; /timezone overrides it per client
+		markdownEnabled:   true,
+		firstRender:       true,
+		connectedAt:       now(),
 	}
 }
 
@@ -281,28 +756,123 @@ func (c *Client) Wait() {
 	c.wg.Wait()
 }
 
+// Close stops the client. Before the render loop is torn down the screen
+// is rendered one last time, so that a final message such as a ban notice
+// appended just before Close still reaches the user. Close never waits on
+// the peer for longer than flushTimeout, see flush.
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
+		c.flush()
 		close(c.done)
 	})
 }
 
+// flushTimeout bounds how long Close waits for the final frame. A peer
+// that stopped reading can block the write for good.
+const flushTimeout = time.Second
+
+// flush drops pending update notifications and renders one last frame, on
+// a best-effort basis: it is skipped if a render is already in progress
+// (possibly stuck writing to the peer), and abandoned after flushTimeout.
+// Write errors are ignored; the client is going away anyway.
+func (c *Client) flush() {
+	for drained := false; !drained; {
+		select {
+		case <-c.updateCh:
+		default:
+			drained = true
+		}
+	}
+	if !c.renderMu.TryLock() {
+		return
+	}
+	rendered := make(chan struct{})
+	go func() {
+		defer c.renderMu.Unlock()
+		defer close(rendered)
+		_ = c.renderLocked()
+	}()
+	timer := time.NewTimer(flushTimeout)
+	defer timer.Stop()
+	select {
+	case <-rendered:
+	case <-timer.C:
+	}
+}
+
 func (c *Client) Notify() {
 	select {
-	case c.updateCh <- struct{}{}:
+	case c.updateCh <- time.Now():
+	default:
+	}
+}
+
+// hasPendingUpdate reports whether a notification is waiting for the render
+// loop. A closed client never has pending updates.
+func (c *Client) hasPendingUpdate() bool {
+	select {
+	case <-c.done:
+		return false
 	default:
+		return len(c.updateCh) > 0
 	}
 }
 
 // NotifyWithBell sends a notification with optional bell character
 func (c *Client) NotifyWithBell(withBell bool) {
-	if withBell {
+	if withBell && !c.plain {
 		// Send bell character before the update notification
 		c.session.Write([]byte("\a"))
 	}
 	c.Notify()
 }
 
+// maxNotices bounds the number of private notices kept per client.
+const maxNotices = 100
+
+// markUnread counts a newly arrived message if the client is scrolled up
+// and therefore not looking at it.
+func (c *Client) markUnread() {
+	c.mu.Lock()
+	if c.scrollOffset > 0 {
+		c.unreadCount++
+	}
+	c.mu.Unlock()
+}
+
+// Nick returns the client's current nickname.
+func (c *Client) Nick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nickname
+}
+
+// SendNotice shows a server message to this client only. Notices are not
+// stored in the shared history; render merges them in by time.
+func (c *Client) SendNotice(text string) {
+	c.mu.Lock()
+	c.notices = append(c.notices, Message{
+		Type:     MsgTypeSystem,
+		Time:     now(),
+		Nick:     "server",
+		Text:     text,
+		Color:    systemColors.System,
+		IsSystem: true,
+	})
+	if len(c.notices) > maxNotices {
+		c.notices = c.notices[len(c.notices)-maxNotices:]
+	}
+	c.mu.Unlock()
+	c.Notify()
+}
+
+// Smallest terminal the full-screen UI can be drawn in. Below this size
+// rendering is paused until the terminal is resized.
+const (
+	minTermWidth  = 10
+	minTermHeight = 4
+)
+
 func (c *Client) SetWindowSize(width, height int) {
 	c.mu.Lock()
 	if width > 0 && width <= 8192 {
@@ -311,6 +881,7 @@ func (c *Client) SetWindowSize(width, height int) {
 	if height > 0 && height <= 8192 {
 		c.height = height
 	}
+	c.tooSmall = c.width < minTermWidth || c.height < minTermHeight
 	c.mu.Unlock()
 	c.Notify()
 }
@@ -325,24 +896,77 @@ func (c *Client) MonitorWindow(winCh <-chan ssh.Window) {
 func (c *Client) renderLoop() {
 	for {
 		select {
-		case <-c.updateCh:
-			c.render()
+		case notifiedAt := <-c.updateCh:
+			if err := c.render(); err != nil {
+				c.Close()
+				return
+			}
+			renderLatency.Observe(time.Since(notifiedAt))
 		case <-c.done:
 			return
 		}
 	}
 }
 
-func (c *Client) render() {
-	allMessages := c.server.Messages()
+func (c *Client) render() error {
+	// Serialize with flush, which renders from outside the render loop.
+	c.renderMu.Lock()
+	defer c.renderMu.Unlock()
+	return c.renderLocked()
+}
+
+// renderLocked is render for a caller that already holds renderMu.
+func (c *Client) renderLocked() error {
+	if c.plain {
+		return c.renderPlain()
+	}
+	if now().Before(c.holdRenderUntil) {
+		return nil // paused by /save
+	}
+	defer c.recordRenderLatency(time.Now())
+
+	serverMessages := c.server.Messages()
 
 	c.mu.Lock()
 	width := c.width
 	height := c.height
 	scroll := c.scrollOffset
+	if scroll == 0 {
+		c.unreadCount = 0
+	}
+	unread := c.unreadCount
 	inputCopy := append([]rune(nil), c.inputBuffer...)
+	allMessages := mergeMessages(filterBlocked(serverMessages, c.blocked), c.notices)
+	opts := viewOptions{tz: c.tz, use12Hour: c.use12Hour, hyperlinks: c.caps.Hyperlinks, markdown: c.markdownEnabled, lookup: c.server.MessageByID}
+	tooSmall := c.tooSmall
+	color := c.color
+	nick := c.nickname
+	searchMode, searchText := c.searchMode, c.searchQuery
+	accessible := c.accessibleMode
 	c.mu.Unlock()
 
+	if accessible {
+		return c.renderAccessible(inputCopy, opts)
+	}
+
+	if c.firstRender {
+		c.firstRender = false
+		if err := c.sendCapabilityProbe(); err != nil {
+			return err
+		}
+	}
+
+	if tooSmall {
+		// Cursor positioning is useless at this size; say so once, in plain text.
+		if c.renderPaused {
+			return nil
+		}
+		c.renderPaused = true
+		return c.writeFrame([]byte("\r\nTerminal too small\r\n"))
+	}
+	resumed := c.renderPaused
+	c.renderPaused = false
+
 	if width <= 0 {
 		width = 80
 	}
@@ -355,26 +979,64 @@ func (c *Client) render() {
 		messageArea = 1
 	}
 
+	if *maxScroll > 0 && scroll > *maxScroll {
+		scroll = *maxScroll
+		c.mu.Lock()
+		c.scrollOffset = scroll
+		c.mu.Unlock()
+	}
+
 	// [OPTIMIZATION]
 	// 필요한 라인만 생성합니다. 화면 영역(messageArea)과 스크롤 오프셋(scroll)을
 	// 합친 만큼의 라인을 최신 메시지부터 역순으로 생성합니다.
 	neededLines := messageArea + scroll
 	var relevantLines []string
 
-	// 전체 메시지를 역순으로 순회합니다.
-	for i := len(allMessages) - 1; i >= 0; i-- {
-		msg := allMessages[i]
+	// In search mode, matchAt is the number of lines below the newest
+	// matching message, or -1 while no match has been formatted yet.
+	query := strings.ToLower(searchText)
+	matchAt := -1
+	next := len(allMessages) - 1
+	addOlder := func() {
+		msg := allMessages[next]
+		next--
 		// 메시지 하나를 포맷팅하여 라인들로 변환합니다.
-		msgLines := formatMessage(msg, width)
-
+		msgLines := formatMessage(msg, width, opts)
+		if searchMode && messageMatches(msg, query) {
+			if matchAt < 0 {
+				matchAt = len(relevantLines)
+			}
+			msgLines = highlightSearchLines(msgLines)
+		}
 		// 생성된 라인들을 `relevantLines`의 앞쪽에 추가합니다.
 		// 이렇게 하면 메시지 순서가 올바르게 유지됩니다.
 		relevantLines = append(msgLines, relevantLines...)
+	}
 
-		// 필요한 만큼의 라인이 모이면 더 이상 메시지를 처리하지 않고 루프를 종료합니다.
-		if len(relevantLines) >= neededLines {
-			break
+	// 전체 메시지를 역순으로 순회하고, 필요한 만큼의 라인이 모이면 멈춥니다.
+	for next >= 0 && len(relevantLines) < neededLines {
+		addOlder()
+	}
+	if searchMode && query != "" {
+		for next >= 0 && matchAt < 0 {
+			addOlder()
 		}
+		// Scroll so the newest match is on screen if it is not already.
+		visible := matchAt >= scroll && matchAt < scroll+messageArea
+		reachable := *maxScroll <= 0 || matchAt <= *maxScroll
+		if matchAt >= 0 && !visible && reachable {
+			scroll = matchAt
+			c.mu.Lock()
+			c.scrollOffset = scroll
+			c.mu.Unlock()
+			for next >= 0 && len(relevantLines) < messageArea+scroll {
+				addOlder()
+			}
+		}
+	}
+
+	if next < 0 {
+		relevantLines = append([]string{topOfHistoryLine}, relevantLines...)
 	}
 
 	totalLines := len(relevantLines)
@@ -402,12 +1064,50 @@ func (c *Client) render() {
 
 	// 화면에 표시할 최종 라인들을 선택합니다.
 	displayLines := relevantLines[start:end]
+	if next >= 0 && *maxScroll > 0 && scroll >= *maxScroll && len(displayLines) > 0 {
+		// Older messages exist but are beyond -max-scroll.
+		displayLines[0] = topOfHistoryLine
+	}
 
-	status := fmt.Sprintf("Users:%d Messages:%d Scroll:%d/%d ↑/↓ to scroll", c.server.ClientCount(), len(allMessages), scroll, maxOffset)
+	scrollHint := "↑/↓ to scroll"
+	if !c.caps.UTF8 {
+		scrollHint = "Up/Down to scroll"
+	}
+	status := fmt.Sprintf("Users:%d Messages:%d Scroll:%d/%d%s %s", c.server.ClientCount(), lastMessageID(serverMessages), scroll, maxOffset, slowModeIndicator(c.server.SlowMode()), scrollHint)
+	if scroll > 0 {
+		// Put the indicator first so fitString never cuts it off.
+		arrow := "↓"
+		if !c.caps.UTF8 {
+			arrow = "v"
+		}
+		indicator := fmt.Sprintf("(%s new messages) ", arrow)
+		if unread > 0 {
+			indicator = fmt.Sprintf("(%s %d new) ", arrow, unread)
+		}
+		status = indicator + status
+	}
+	if !serverStartTime.IsZero() {
+		uptime := " Up:" + formatDuration(time.Since(serverStartTime))
+		if len([]rune(status))+len([]rune(uptime)) <= width {
+			status += uptime
+		}
+	}
 	status = fitString(status, width)
 
+	// Prompt shows the user's own nick in their color, unless the terminal
+	// is too narrow to spare the room.
+	prompt, promptWidth := "> ", 2
+	if width >= 20 {
+		prompt = fmt.Sprintf("\x1b[%dm%s\x1b[0m> ", color, nick)
+		promptWidth = len([]rune(nick)) + 2
+	}
+
 	inputText := string(inputCopy)
-	inputLimit := width - 2
+	if searchMode {
+		prompt, promptWidth = "/search: ", 9
+		inputText = searchText
+	}
+	inputLimit := width - promptWidth
 	if inputLimit < 1 {
 		inputLimit = width
 	}
@@ -415,6 +1115,9 @@ func (c *Client) render() {
 
 	var b strings.Builder
 	b.Grow((messageArea + 3) * (width + 8))
+	if resumed {
+		b.WriteString("\x1b[2J")
+	}
 	b.WriteString("\x1b[?25l")
 	b.WriteString("\x1b[H")
 
@@ -431,23 +1134,120 @@ func (c *Client) render() {
 	b.WriteByte('\n')
 
 	b.WriteString("\x1b[2K")
-	b.WriteString("> ")
+	b.WriteString(prompt)
 	b.WriteString(inputText)
 	b.WriteString("\x1b[K")
 	b.WriteString("\x1b[?25h")
 
-	if _, err := c.session.Write([]byte(b.String())); err != nil {
-		c.Close()
+	return c.writeFrame([]byte(b.String()))
+}
+
+// Render writes are retried this many times, waiting renderRetryDelay and
+// then twice as long after each failure, before the client is closed. This
+// rides out short stalls such as a mobile connection switching networks.
+const (
+	renderRetries    = 3
+	renderRetryDelay = 100 * time.Millisecond
+)
+
+// writeFrame writes data to the session, retrying with exponential backoff.
+// The caller holds renderMu.
+func (c *Client) writeFrame(data []byte) error {
+	delay := renderRetryDelay
+	for attempt := 0; ; attempt++ {
+		n, err := c.session.Write(data)
+		if err == nil {
+			c.writeFailCount = 0
+			return nil
+		}
+		data = data[n:]
+		c.writeFailCount++
+		if attempt == renderRetries {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// invalidUTF8Bytes counts input bytes dropped because they were not valid UTF-8.
+var invalidUTF8Bytes atomic.Uint64
+
+// inputEvent is one result of bufio.Reader.ReadRune.
+type inputEvent struct {
+	r    rune
+	size int
+	err  error
+}
+
+// escapeTimeout bounds the wait for the bytes following ESC. If they do not
+// arrive in time (split packets on a slow link, or a bare ESC key press)
+// the sequence is abandoned instead of blocking the input loop.
+const escapeTimeout = 50 * time.Millisecond
+
+// readInput forwards runes from reader until it fails or the client closes.
+func (c *Client) readInput(reader *bufio.Reader, input chan<- inputEvent) {
+	for {
+		r, size, err := reader.ReadRune()
+		select {
+		case input <- inputEvent{r: r, size: size, err: err}:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// nextInput waits up to timeout for the next rune of an escape sequence.
+func (c *Client) nextInput(input <-chan inputEvent, timeout time.Duration) (rune, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ev := <-input:
+		if ev.err != nil {
+			c.Close()
+			return 0, false
+		}
+		return ev.r, true
+	case <-timer.C:
+		return 0, false
+	case <-c.done:
+		return 0, false
 	}
 }
 
 func (c *Client) inputLoop(reader *bufio.Reader) {
+	if c.plain {
+		c.plainInputLoop(reader)
+		return
+	}
+
+	input := make(chan inputEvent)
+	go c.readInput(reader, input)
+
 	for {
-		r, _, err := reader.ReadRune()
+		var ev inputEvent
+		select {
+		case ev = <-input:
+		case <-c.done:
+			return
+		}
+		r, size, err := ev.r, ev.size, ev.err
 		if err != nil {
 			c.Close()
 			return
 		}
+		if r == unicode.ReplacementChar && size == 1 {
+			// Invalid UTF-8 byte from a malformed client; drop it.
+			invalidUTF8Bytes.Add(1)
+			continue
+		}
 
 		switch r {
 		case '\r':
@@ -462,8 +1262,10 @@ func (c *Client) inputLoop(reader *bufio.Reader) {
 		case 4: // Ctrl+D
 			c.Close()
 			return
+		case 6: // Ctrl+F
+			c.enterSearchMode()
 		case '\x1b':
-			c.handleEscape(reader)
+			c.handleEscape(input)
 		default:
 			if !isControlRune(r) {
 				c.handleRune(r)
@@ -473,8 +1275,17 @@ func (c *Client) inputLoop(reader *bufio.Reader) {
 }
 
 func (c *Client) handleEnter() {
+	if c.inSearchMode() {
+		c.exitSearchMode()
+		return
+	}
+
 	c.mu.Lock()
-	text := strings.TrimSpace(string(c.inputBuffer))
+	// handleRune already filters control input, but strip again so nothing
+	// that reached the buffer another way ends up in logs or other terminals.
+	// NFC composes decomposed accents (e + U+0301 -> é) so they pass
+	// ValidateNoCombining and mentions match nicks stored in NFC.
+	text := norm.NFC.String(strings.TrimSpace(stripControlRunes(string(c.inputBuffer))))
 	c.inputBuffer = c.inputBuffer[:0]
 	c.scrollOffset = 0
 	c.mu.Unlock()
@@ -488,97 +1299,104 @@ func (c *Client) handleEnter() {
 		return
 	}
 
+	if c.honeypot {
+		// Banned client in the honeypot: no commands, no rate limiting, and
+		// the message only ever reaches its own HoneypotRoom.
+		c.server.AppendMessage(Message{
+			Type:  MsgTypeUser,
+			Time:  now(),
+			Nick:  c.Nick(),
+			Text:  text,
+			Color: c.color,
+			IP:    c.ip,
+		})
+		return
+	}
+
 	c.mu.Lock()
-	now := time.Now()
-	oneMinuteAgo := now.Add(-time.Minute)
+	sentAt := time.Now()
+	oneMinuteAgo := sentAt.Add(-time.Minute)
 
-	// Filter timestamps older than one minute
+	// Filter timestamps older than one minute, along with their byte counts
 	n := 0
-	for _, ts := range c.messageTimestamps {
+	for i, ts := range c.messageTimestamps {
 		if ts.After(oneMinuteAgo) {
 			c.messageTimestamps[n] = ts
+			c.messageSizes[n] = c.messageSizes[i]
 			n++
+		} else {
+			c.bytesThisMinute -= uint64(c.messageSizes[i])
 		}
 	}
 	c.messageTimestamps = c.messageTimestamps[:n]
+	c.messageSizes = c.messageSizes[:n]
 
 	// Add current message timestamp
-	c.messageTimestamps = append(c.messageTimestamps, now)
+	c.messageTimestamps = append(c.messageTimestamps, sentAt)
+	c.messageSizes = append(c.messageSizes, len(text))
+	c.bytesThisMinute += uint64(len(text))
 	messageCount := len(c.messageTimestamps)
+	bytesThisMinute := c.bytesThisMinute
 	c.mu.Unlock()
 
-	if messageCount > 30 {
-		log.Printf("Kicking client %s (%s) for spamming.", c.nickname, c.ip)
-		banManager.Ban(c.ip)
-		msg := fmt.Sprintf("야 `%s` 나가.", c.nickname)
-		c.server.AppendSystemMessage(msg)
-		c.session.Exit(1)
-		c.Close()
+	if messageCount == spamWarnMessages {
+		c.server.BroadcastToAdmins(fmt.Sprintf("%s (%s) is approaching the spam limit: %d messages in the last minute", c.Nick(), c.ip, messageCount))
+	}
+	if messageCount > spamLimitMessages {
+		// banWithReason disconnects every session from the IP, including this one.
+		c.state.banWithReason(c.ip, fmt.Sprintf("spamming as %s", c.Nick()), "server")
+		return
+	}
+	if *maxBytesPerMin > 0 && bytesThisMinute > uint64(*maxBytesPerMin) {
+		c.state.banWithReason(c.ip, fmt.Sprintf("flooding as %s (%d bytes/min)", c.Nick(), bytesThisMinute), "server")
 		return
 	}
 
 	// Commands
-	if strings.HasPrefix(text, "/ban ") {
-		target := strings.TrimSpace(strings.TrimPrefix(text, "/ban "))
-		// Allow just IP (IPv4/IPv6). No CIDR support for simplicity.
-		if ip := net.ParseIP(target); ip == nil {
-			c.server.AppendSystemMessage("Invalid IP address")
-			return
-		}
-		banManager.Ban(target)
-		disconnected := c.server.DisconnectByIP(target)
-		c.server.AppendSystemMessage(fmt.Sprintf("IP %s banned. Disconnected %d session(s).", target, disconnected))
+	if strings.HasPrefix(text, "/") && c.handleCommand(text) {
 		return
 	}
 
-	c.server.AppendMessage(Message{
-		Time:  time.Now(),
-		Nick:  c.nickname,
-		Text:  text,
-		Color: c.color,
-		IP:    c.ip,
-	})
+	c.sendMessage(text, 0)
+}
 
-	if strings.Contains(text, "rm -") {
-		c.server.AppendSystemMessage("이거 리눅스아니에요. 윈도 파워쉘요.")
-	}
-	if strings.Contains(text, "rd ") {
-		c.server.AppendSystemMessage("이거 윈도 아니에요. 리눅스요.")
-	}
-	if strings.Contains(text, "스프링") {
-		c.server.AppendSystemMessage("물러가라 이 사악한 스프링놈아.")
-	}
-	if strings.Contains(text, "자바") && !strings.Contains(text, "자바스") {
-		c.server.AppendSystemMessage("망해라 자바")
-	}
-	if strings.Contains(text, "자스") || strings.Contains(text, "자바스") || strings.Contains(text, "javascript") {
-		c.server.AppendSystemMessage("https://jsisweird.com/")
-	}
-	if strings.Contains(text, "러스트") || strings.Contains(text, "rust") {
-		c.server.AppendSystemMessage("Go: Kubernetes, fzf, Tailscale, Typescript-go, ... / Rust: nil")
-	}
-	if strings.Contains(text, "파이썬") || strings.Contains(text, "python") {
-		c.server.AppendSystemMessage("자기 스스로도 컴파일 못하는 허접한 언어.")
-	}
-	if strings.Contains(text, "고랭") {
-		c.server.AppendSystemMessage("돈 못벌쥬? 마이너쥬?")
-	}
-	if strings.Contains(text, "쿠버네티스") {
-		c.server.AppendSystemMessage("이 방 방장 밥줄이에요. 나쁜말하면 영구 밴")
+// sendMessage posts text as a chat message from c, optionally as a reply to
+// message replyTo, and triggers any matching easter eggs.
+func (c *Client) sendMessage(text string, replyTo uint64) {
+	if !c.allowSlowMode() {
+		return
 	}
 
-	if strings.Contains(text, "exit") {
-		c.server.AppendSystemMessage("exit 안되요. 그냥 ctrl + c 하시죠")
-	}
+	// Read nick and color together so a concurrent /rename cannot split them.
+	c.mu.Lock()
+	nick, color := c.nickname, c.color
+	c.sentCount++
+	c.mu.Unlock()
+
+	c.server.AppendMessage(Message{
+		Type:    MsgTypeUser,
+		Time:    now(),
+		Nick:    nick,
+		Text:    text,
+		Color:   color,
+		IP:      c.ip,
+		ReplyTo: replyTo,
+	})
 
-	if strings.Contains(text, "help") {
-		c.server.AppendSystemMessage("help? 인생은 실전이에요.")
+	for i := range easterEggs {
+		if easterEggs[i].Match(text) {
+			c.server.AppendServerMessage(MsgTypeEasterEgg, easterEggs[i].Response)
+		}
 	}
 }
 
 func (c *Client) handleBackspace() {
 	c.mu.Lock()
-	if len(c.inputBuffer) > 0 {
+	if c.searchMode {
+		if q := []rune(c.searchQuery); len(q) > 0 {
+			c.searchQuery = string(q[:len(q)-1])
+		}
+	} else if len(c.inputBuffer) > 0 {
 		c.inputBuffer = c.inputBuffer[:len(c.inputBuffer)-1]
 	}
 	c.mu.Unlock()
@@ -587,29 +1405,45 @@ func (c *Client) handleBackspace() {
 
 func (c *Client) handleRune(r rune) {
 	c.mu.Lock()
-	c.inputBuffer = append(c.inputBuffer, r)
+	if c.searchMode {
+		c.searchQuery += string(r)
+	} else {
+		c.inputBuffer = append(c.inputBuffer, r)
+	}
 	c.mu.Unlock()
 	c.Notify()
 }
 
-func (c *Client) handleEscape(reader *bufio.Reader) {
-	b1, err := reader.ReadByte()
-	if err != nil {
-		c.Close()
+func (c *Client) handleEscape(input <-chan inputEvent) {
+	b1, ok := c.nextInput(input, escapeTimeout)
+	if !ok {
+		// A bare ESC closes the search bar.
+		if c.inSearchMode() {
+			c.exitSearchMode()
+		}
+		return
+	}
+	if b1 == 'P' && c.awaitingProbe() {
+		c.handleDCS(input)
 		return
 	}
 	if b1 != '[' {
 		return
 	}
-	b2, err := reader.ReadByte()
-	if err != nil {
-		c.Close()
+	b2, ok := c.nextInput(input, escapeTimeout)
+	if !ok {
+		return
+	}
+	if (b2 >= '0' && b2 <= '9') || b2 == ';' {
+		c.handleCSIWithParams(input, b2)
 		return
 	}
 	switch b2 {
 	case 'A':
 		c.mu.Lock()
-		c.scrollOffset++
+		if *maxScroll <= 0 || c.scrollOffset < *maxScroll {
+			c.scrollOffset++
+		}
 		c.mu.Unlock()
 		c.Notify()
 	case 'B':
@@ -622,25 +1456,164 @@ func (c *Client) handleEscape(reader *bufio.Reader) {
 	}
 }
 
+// handleDCS reads a DCS string up to its terminator (ESC \ or BEL). The
+// only one expected is the DECRQSS answer to the capability probe.
+func (c *Client) handleDCS(input <-chan inputEvent) {
+	var data []rune
+	for len(data) <= maxDCSLen {
+		r, ok := c.nextInput(input, escapeTimeout)
+		if !ok {
+			return
+		}
+		switch r {
+		case '\a':
+			c.handleSGRReport(string(data))
+			return
+		case '\x1b':
+			if next, ok := c.nextInput(input, escapeTimeout); ok && next == '\\' {
+				c.handleSGRReport(string(data))
+			}
+			return
+		}
+		data = append(data, r)
+	}
+}
+
+// handleCSIWithParams reads the rest of a CSI sequence whose first
+// parameter byte was first, so that replies such as the cursor position
+// report are not typed into the input buffer.
+func (c *Client) handleCSIWithParams(input <-chan inputEvent, first rune) {
+	params := []rune{first}
+	for len(params) <= maxCSIParams {
+		r, ok := c.nextInput(input, escapeTimeout)
+		if !ok {
+			return
+		}
+		if r >= 0x40 && r <= 0x7e { // final byte
+			if r == 'R' {
+				c.handleCursorReport(string(params))
+			}
+			return
+		}
+		params = append(params, r)
+	}
+}
+
+// lastMessageID returns the ID of the newest message in msgs, or 0.
+func lastMessageID(msgs []Message) uint64 {
+	if len(msgs) == 0 {
+		return 0
+	}
+	return msgs[len(msgs)-1].ID
+}
+
+// mergeMessages merges two time-ordered message slices into a new one.
+func mergeMessages(a, b []Message) []Message {
+	if len(b) == 0 {
+		return a
+	}
+	out := make([]Message, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j].Time.Before(a[i].Time) {
+			out = append(out, b[j])
+			j++
+		} else {
+			out = append(out, a[i])
+			i++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// isControlRune reports whether r is a C0 or C1 control character, or one of
+// the Unicode format characters that terminals and log files treat as
+// control codes (line/paragraph separators and the byte order mark).
 func isControlRune(r rune) bool {
-	return r < 32 || r == 127
+	switch {
+	case r < 32 || r == 127:
+		return true
+	case r >= 0x80 && r <= 0x9f: // C1 controls, e.g. U+009B (CSI)
+		return true
+	case r == '\u2028' || r == '\u2029' || r == '\ufeff':
+		return true
+	}
+	return false
+}
+
+// stripControlRunes removes NUL bytes and other control characters from s.
+func stripControlRunes(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isControlRune(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// viewOptions carries the per-client display settings used by formatMessage.
+type viewOptions struct {
+	tz         *time.Location
+	use12Hour  bool
+	hyperlinks bool // wrap @mentions in OSC 8 links
+	markdown   bool // apply renderMarkdown to message text
+
+	// lookup finds a message by ID for reply quotes; may be nil.
+	lookup func(id uint64) (Message, bool)
+}
+
+func (o viewOptions) timeLayout() string {
+	if o.use12Hour {
+		return "3:04:05 PM"
+	}
+	return "15:04:05"
 }
 
+// tabSpaces replaces each tab in message text before wrapping.
+const tabSpaces = "    "
+
 // [HELPER] O(n) 로직을 분리하기 위해, 메시지 '하나'만 포맷하는 헬퍼 함수를 만들었습니다.
-func formatMessage(msg Message, width int) []string {
+//
+// The nick is always drawn in msg.Color, never in the color of a client
+// that currently has that nick: the color is captured when the message is
+// created (typ.Color() for server messages, the sender's color for user
+// messages), so server messages stay consistent and a later /color or
+// /rename does not repaint history.
+func formatMessage(msg Message, width int, opts viewOptions) []string {
 	color := msg.Color
 	if color == 0 {
 		color = 37 // default to white
 	}
 	coloredNick := fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, msg.Nick)
 
-	// Highlight mentions in the message text
-	highlightedText := highlightMentions(msg.Text, msg.Mentions)
+	// Shorten long URLs, apply markdown, then highlight mentions in the
+	// message text. A tab's width depends on the cursor column, which the
+	// server does not track, so wrapString would miscount it; tabs are
+	// expanded to fixed spaces first.
+	text := shortenURLs(strings.ReplaceAll(msg.Text, "\t", tabSpaces), opts.hyperlinks)
+	if opts.markdown {
+		text = renderMarkdown(text)
+	}
+	highlightedText := highlightMentions(text, msg.Mentions, opts.hyperlinks)
 
-	prefix := fmt.Sprintf("[%s] %s: ", msg.Time.Format("15:04:05"), coloredNick)
-	indent := strings.Repeat(" ", len(msg.Nick)+13)
+	tz := opts.tz
+	if tz == nil {
+		tz = time.UTC
+	}
+	stamp := msg.Time.In(tz).Format(opts.timeLayout())
+	prefix := fmt.Sprintf("[%s] %s: ", stamp, coloredNick)
+	indent := strings.Repeat(" ", len(msg.Nick)+len(stamp)+5)
 
+	// Replies get a dim quote of the original above them and are indented.
 	var lines []string
+	bodyIndent := ""
+	if msg.ReplyTo != 0 {
+		bodyIndent = replyIndent
+		width -= len(replyIndent)
+		lines = append(lines, replyIndent+"\x1b[2m"+fitString(replyQuote(msg.ReplyTo, opts), width)+"\x1b[0m")
+	}
+
 	segments := strings.Split(highlightedText, "\n")
 	for i, segment := range segments {
 		base := segment
@@ -649,12 +1622,36 @@ func formatMessage(msg Message, width int) []string {
 		} else {
 			base = indent + segment
 		}
-		wrapped := wrapString(base, width)
-		lines = append(lines, wrapped...)
+		for _, line := range wrapString(base, width) {
+			lines = append(lines, bodyIndent+line)
+		}
 	}
 	return lines
 }
 
+// replyIndent is prepended to every line of a reply.
+const replyIndent = "  "
+
+// replyQuoteLen is how many characters of the original a reply quotes.
+const replyQuoteLen = 30
+
+// replyQuote returns "↩ nick: first words" for the message with ID id, or
+// a placeholder if it is no longer in the history.
+func replyQuote(id uint64, opts viewOptions) string {
+	if opts.lookup == nil {
+		return fmt.Sprintf("↩ message #%d", id)
+	}
+	orig, ok := opts.lookup(id)
+	if !ok {
+		return fmt.Sprintf("↩ message #%d (no longer in history)", id)
+	}
+	text := []rune(strings.Join(strings.Fields(stripANSI(orig.Text)), " "))
+	if len(text) > replyQuoteLen {
+		text = append(text[:replyQuoteLen], '…')
+	}
+	return fmt.Sprintf("↩ %s: %s", orig.Nick, string(text))
+}
+
 func wrapString(s string, width int) []string {
 	if width <= 0 {
 		width = 80
@@ -672,17 +1669,12 @@ func wrapString(s string, width int) []string {
 		// 임시: 이스케이프 시퀀스를 무시하는 간단한 방법 (정확하지 않을 수 있음)
 		var currentWidth int
 		var breakIndex int = -1
-		inEscape := false
-		for i, r := range runes {
-			if r == '\x1b' {
-				inEscape = true
-			}
-			if !inEscape {
-				currentWidth++
-			}
-			if r == 'm' && inEscape {
-				inEscape = false
+		for i := 0; i < len(runes); i++ {
+			if n := escapeLen(runes[i:]); n > 0 {
+				i += n - 1
+				continue
 			}
+			currentWidth++
 			if currentWidth > width {
 				breakIndex = i
 				break
@@ -698,7 +1690,7 @@ func wrapString(s string, width int) []string {
 		if breakIndex > 0 {
 			// 이스케이프 코드가 아닌 문자만 검사
 			tempRunes := []rune{}
-			inEscape = false
+			inEscape := false
 			for _, r := range runes[:breakIndex] {
 				if r == '\x1b' {
 					inEscape = true
@@ -728,6 +1720,38 @@ func wrapString(s string, width int) []string {
 	return result
 }
 
+// escapeLen returns the number of runes in the escape sequence at the start
+// of runes, or 0 if runes does not start with ESC. CSI sequences end at their
+// final byte; OSC sequences (e.g. OSC 8 hyperlinks) end at BEL or ST.
+func escapeLen(runes []rune) int {
+	if len(runes) == 0 || runes[0] != '\x1b' {
+		return 0
+	}
+	if len(runes) < 2 {
+		return 1
+	}
+	switch runes[1] {
+	case '[':
+		for i := 2; i < len(runes); i++ {
+			if runes[i] >= 0x40 && runes[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']':
+		for i := 2; i < len(runes); i++ {
+			if runes[i] == '\a' {
+				return i + 1
+			}
+			if runes[i] == '\x1b' && i+1 < len(runes) && runes[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return 2
+	}
+	return len(runes)
+}
+
 func fitString(s string, width int) string {
 	if width <= 0 {
 		return s
@@ -750,112 +1774,336 @@ func tailString(s string, width int) string {
 	return string(runes[len(runes)-width:])
 }
 
-func generateGuestNickname() string {
-	id := atomic.AddUint64(&guestCounter, 1)
-	return fmt.Sprintf("guest-%d", id)
+// formatDuration renders d using its two most significant units,
+// e.g. "2d 3h", "3h 15m" or "15m 4s".
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	}
 }
 
-func main() {
-	quitCh := make(chan os.Signal, 1)
-	signal.Notify(quitCh, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+var (
+	guestPrefix = flag.String("guest-prefix", "guest", "prefix for generated guest nicknames; the numeric suffix restarts at 1 whenever the server restarts")
+	guestRandom = flag.Bool("guest-random", false, "use a random 4-character guest suffix instead of an incrementing number")
+)
 
-	// ssh.Handler 그대로 사용
-	h := func(s ssh.Session) {
-		ptyReq, winCh, isPty := s.Pty()
-		if !isPty {
-			fmt.Fprintln(s, "Error: PTY required. Reconnect with -t option.")
-			_ = s.Exit(1)
-			return
-		}
+const guestSuffixChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// remoteIP returns the client's IP address without the port.
+func remoteIP(s ssh.Session) string {
+	remote := s.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
 
-		reader := bufio.NewReader(s)
+// logConnectionAttempt writes an audit line for every new session, before
+// any ban or rate-limit decision is made.
+func logConnectionAttempt(s ssh.Session, ip string) {
+	pubKey := s.PublicKey()
+	fingerprint := "-"
+	if pubKey != nil {
+		fingerprint = gossh.FingerprintSHA256(pubKey)
+	}
+	log.Printf("connection attempt ip=%s user=%q pubkey=%t fingerprint=%s", ip, s.User(), pubKey != nil, fingerprint)
+}
 
-		remote := s.RemoteAddr().String()
-		ip := remote
-		if host, _, err := net.SplitHostPort(remote); err == nil {
-			ip = host
+func (st *ServerState) generateGuestNickname() string {
+	if *guestRandom {
+		suffix := make([]byte, 4)
+		for i := range suffix {
+			suffix[i] = guestSuffixChars[rand.Intn(len(guestSuffixChars))]
 		}
+		return fmt.Sprintf("%s-%s", *guestPrefix, suffix)
+	}
+	id := st.guestCounter.Add(1)
+	return fmt.Sprintf("%s-%d", *guestPrefix, id)
+}
 
-		if banManager.IsBanned(ip) {
-			fmt.Fprintln(s, "Your IP is banned.")
-			_ = s.Exit(1)
-			return
-		}
+// handleSession serves one interactive chat session until the client
+// disconnects.
+func (st *ServerState) handleSession(s ssh.Session) {
+	defer logPanic()
+	ip := remoteIP(s)
+	logConnectionAttempt(s, ip)
+	if !st.Throttle.Allow() {
+		fmt.Fprintln(s, "Server busy, try again shortly.")
+		_ = s.Exit(1)
+		return
+	}
+	certInfo := certInfoFromKey(s.PublicKey())
+	if certInfo != nil {
+		log.Printf("user certificate ip=%s user=%q %s", ip, s.User(), certInfo)
+	}
+	fingerprint := ""
+	if pubKey := s.PublicKey(); pubKey != nil {
+		fingerprint = gossh.FingerprintSHA256(pubKey)
+	}
 
-		if !rateLimiter.CheckAndRecord(ip) {
-			log.Printf("Banning IP %s for too many connections.", ip)
-			banManager.Ban(ip)
-			disconnected := globalChat.DisconnectByIP(ip)
-			log.Printf("Disconnected %d existing session(s) from %s.", disconnected, ip)
-			fmt.Fprintln(s, "Your IP is banned for creating too many connections.")
-			_ = s.Exit(1)
+	if cmd := s.RawCommand(); cmd != "" {
+		log.Printf("rejected exec request ip=%s user=%q command=%q", ip, s.User(), cmd)
+		fmt.Fprintln(s.Stderr(), "This server is a chat server and does not run commands. Connect normally with: ssh <user>@<host>")
+		_ = s.Exit(1)
+		return
+	}
+
+	ptyReq, winCh, isPty := s.Pty()
+	if !isPty {
+		fmt.Fprintln(s, "Error: PTY required. Reconnect with -t option, or use the \"chat\" subsystem (ssh -s) for plain-text access.")
+		_ = s.Exit(1)
+		return
+	}
+	if !finishNegotiation(s) {
+		return
+	}
+
+	reader := bufio.NewReader(s)
+
+	if st.Bans.IsBanned(ip) || st.Bans.IsFingerprintBanned(fingerprint) {
+		if *honeypotMode {
+			st.serveHoneypot(s, ip, ptyReq, winCh, reader)
 			return
 		}
+		fmt.Fprintln(s, "You are banned.")
+		_ = s.Exit(1)
+		return
+	}
+
+	if !st.RateLimiter.CheckAndRecord(ip) {
+		st.banWithReason(ip, "too many connections", "server")
+		fmt.Fprintln(s, "Your IP is banned for creating too many connections.")
+		_ = s.Exit(1)
+		return
+	}
 
-		nickname := strings.TrimSpace(s.User())
-		if nickname == "" {
-			nickname = generateGuestNickname()
+	nickname, reservedNick := st.chooseNick(s.User())
+
+	client := NewClient(st.Chat, s, nickname, int(ptyReq.Window.Width), int(ptyReq.Window.Height), ip, *notifyBuf)
+	client.caps = detectTermCapabilities(s, ptyReq.Term)
+	client.envCaps = client.caps
+	client.state = st
+	client.cert = certInfo
+	client.pubKeyFingerprint = fingerprint
+	client.hasAgentForwarding = ssh.AgentRequested(s)
+	if client.hasAgentForwarding {
+		log.Printf("agent forwarding requested ip=%s nick=%s", ip, nickname)
+		if os.Geteuid() == 0 {
+			log.Printf("warning: server is running as root and %s (%s) requested agent forwarding", nickname, ip)
 		}
-		if len([]rune(nickname)) > 10 {
-			nickname = string([]rune(nickname)[:10])
+	}
+	st.Chat.AddClient(client)
+	defer func() {
+		st.Chat.RemoveClient(client)
+		client.Close()
+		st.Chat.AnnounceLeave(client.Nick())
+	}()
+
+	if *accessibleDefault {
+		client.setAccessible(true)
+	} else {
+		fmt.Fprint(s, "\x1b[2J\x1b[H")
+	}
+	st.Chat.AnnounceJoin(nickname)
+	if reservedNick != "" {
+		client.SendNotice(fmt.Sprintf("Nickname '%s' is reserved.", reservedNick))
+	}
+	if text := motd.Text(); text != "" {
+		client.SendNotice(text)
+	}
+
+	go client.MonitorWindow(winCh)
+	client.Start(reader, s.Context())
+	client.Wait()
+}
+
+// newSSHServer returns the chat server for addr, without a host key.
+func newSSHServer(addr string, st *ServerState) *ssh.Server {
+	return &ssh.Server{
+		Addr:    addr,
+		Handler: st.handleSession,
+		// gliderlabs/ssh prepends the protocol prefix itself.
+		Version: strings.TrimPrefix(*serverVersion, "SSH-2.0-"),
+		// Bounds the handshake and PTY negotiation, see negotiation.go.
+		ConnCallback: startNegotiationTimer,
+		SubsystemHandlers: map[string]ssh.SubsystemHandler{
+			"chat":   st.handleChatSubsystem,
+			"export": st.handleExportSubsystem,
+			"sftp":   rejectSFTP,
+		},
+	}
+}
+
+// shutdownCountdown plays the shutdown countdown in cs. second is the
+// length of one countdown step; main uses time.Second.
+func shutdownCountdown(cs *ChatServer, reason string, second time.Duration) {
+	renderWait := second * 9 / 10
+	cs.AppendSystemMessage(fmt.Sprintf("서버 폭파 5초전 (%s)", reason))
+	// 매 초마다 모든 클라이언트가 화면을 갱신할 때까지 기다림 (멈춘 클라이언트는 타임아웃)
+	countdown := time.NewTicker(second)
+	for i := 5; i >= 0; i-- {
+		cs.WaitForRenders(renderWait)
+		<-countdown.C
+		cs.AppendSystemMessage(fmt.Sprintf("%d 초", i))
+	}
+	countdown.Stop()
+	cs.WaitForRenders(renderWait)
+	cs.AppendSystemMessage("💥💥💥💥💥")
+	cs.AppendSystemMessage("아마 관리자가 부지런하면 금방 복구할꺼에요.")
+	cs.AppendSystemMessage("💥💥💥💥💥")
+	time.Sleep(3 * second)
+	cs.AppendSystemMessage("뭐야 왜 안터져")
+	time.Sleep(4 * second)
+	cs.AppendSystemMessage("???")
+	time.Sleep(second)
+	cs.AppendSystemMessage("Control + C")
+	time.Sleep(second)
+	cs.AppendSystemMessage("????????????")
+	time.Sleep(second / 2)
+}
+
+func main() {
+	flag.Parse()
+
+	if *serverTimezone != "" {
+		loc, err := time.LoadLocation(*serverTimezone)
+		if err != nil {
+			log.Printf("invalid -timezone %q: %v", *serverTimezone, err)
+		} else {
+			serverLocation = loc
 		}
+	}
+	log.SetFlags(0)
+	log.SetOutput(tzLogWriter{os.Stderr})
+	log.Println(versionString())
 
-		client := NewClient(globalChat, s, nickname, int(ptyReq.Window.Width), int(ptyReq.Window.Height), ip)
-		globalChat.AddClient(client)
-		defer func() {
-			globalChat.RemoveClient(client)
-			client.Close()
-			globalChat.AppendSystemMessage(fmt.Sprintf("%s left the chat", nickname))
-		}()
+	if *maxNickLen < 1 || *maxNickLen > maxNickLenLimit {
+		log.Printf("-max-nick-len must be between 1 and %d; using %d", maxNickLenLimit, defaultMaxNickLen)
+		*maxNickLen = defaultMaxNickLen
+	}
+	loadSystemColors()
 
-		fmt.Fprint(s, "\x1b[2J\x1b[H")
-		globalChat.AppendSystemMessage(fmt.Sprintf("%s joined the chat", nickname))
+	if *useSyslog {
+		if err := openSyslog(); err != nil {
+			log.Printf("failed to open syslog: %v", err)
+		}
+	}
+	if err := motd.Load(*motdPath); err != nil {
+		log.Printf("failed to load motd: %v", err)
+	}
+	if err := adminConfig.Load(*adminConfigPath); err != nil {
+		log.Fatalf("failed to load admin config: %v", err)
+	}
 
-		go client.MonitorWindow(winCh)
-		client.Start(reader, s.Context())
-		client.Wait()
+	if *honeypotMode {
+		if err := openHoneypotLog(*honeypotLog); err != nil {
+			log.Printf("failed to open honeypot log, logging to stderr: %v", err)
+		}
 	}
 
-	// 서버를 객체로 만들어서 Close 할 수 있게
-	srv := &ssh.Server{
-		Addr:    ":2222",
-		Handler: h,
+	eggs, err := loadEasterEggs(*easterEggFile)
+	if err != nil {
+		log.Printf("failed to load easter eggs: %v; using built-in set", err)
+		eggs, _ = parseEasterEggs(defaultEasterEggs)
 	}
-	srv.SetOption(ssh.HostKeyFile("host.key"))
+	easterEggs = eggs
+
+	signal.Notify(quitCh, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
-	// 서버 실행은 고루틴에서; log.Fatal 쓰지 마세요
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
 	go func() {
-		log.Println("starting ssh chat server on port 2222...")
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
-			// 여기서 종료하지 않음
-			log.Printf("ssh server error: %v", err)
-			quitCh <- os.Interrupt
+		for range hupCh {
+			if err := motd.Reload(); err != nil {
+				logError("failed to reload motd: %v", err)
+			} else {
+				log.Println("motd reloaded")
+			}
+			if err := adminConfig.Reload(); err != nil {
+				logError("failed to reload admin config: %v", err)
+			} else if *adminConfigPath != "" {
+				log.Println("admin config reloaded")
+			}
 		}
 	}()
 
+	st := NewServerState()
+
+	serverStartTime = now()
+
+	if *pprofAddr != "" {
+		startPprofServer(*pprofAddr)
+	}
+	if *metricsAddr != "" {
+		startMetricsServer(*metricsAddr, st)
+	}
+
+	if len(listenAddrs) == 0 {
+		listenAddrs = addrList{":2222"}
+	}
+
+	var certChecker *gossh.CertChecker
+	if *userCAFile != "" {
+		cas, err := loadAuthorizedKeys(*userCAFile)
+		if err != nil {
+			log.Printf("failed to load user CA keys: %v", err)
+		} else {
+			certChecker = newCertChecker(cas)
+		}
+	}
+	authConfig, err := loadAuthConfig(*authModeFlag, certChecker)
+	if err != nil {
+		log.Fatalf("invalid authentication settings: %v", err)
+	}
+
+	// 서버를 객체로 만들어서 Close 할 수 있게 (주소마다 하나씩, st.Chat 공유)
+	servers := make([]*ssh.Server, 0, len(listenAddrs))
+	for _, addr := range listenAddrs {
+		srv := newSSHServer(addr, st)
+		srv.SetOption(ssh.HostKeyFile("host.key"))
+		authConfig.Configure(srv, st.Chat)
+		servers = append(servers, srv)
+
+		// 서버 실행은 고루틴에서; log.Fatal 쓰지 마세요
+		go func() {
+			log.Printf("starting ssh chat server on %s...", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				// 여기서 종료하지 않음
+				logError("ssh server error on %s: %v", srv.Addr, err)
+				requestShutdown("SSH server error on " + srv.Addr)
+			}
+		}()
+	}
+
 	// 메인 고루틴은 신호 대기 → 카운트다운 → 서버 종료
-	<-quitCh
+	sig := <-quitCh
+	reason := ShutdownReason(sig)
+	log.Printf("shutting down: %s", reason)
 
-	globalChat.AppendSystemMessage("서버 폭파 5초전")
-	for i := 5; i >= 0; i-- {
-		time.Sleep(time.Second)
-		globalChat.AppendSystemMessage(fmt.Sprintf("%d 초", i))
-	}
-	globalChat.AppendSystemMessage("💥💥💥💥💥")
-	globalChat.AppendSystemMessage("아마 관리자가 부지런하면 금방 복구할꺼에요.")
-	globalChat.AppendSystemMessage("💥💥💥💥💥")
-	time.Sleep(3 * time.Second)
-	globalChat.AppendSystemMessage("뭐야 왜 안터져")
-	time.Sleep(4 * time.Second)
-	globalChat.AppendSystemMessage("???")
-	time.Sleep(time.Second)
-	globalChat.AppendSystemMessage("Control + C")
-	time.Sleep(time.Second)
-	globalChat.AppendSystemMessage("????????????")
-	time.Sleep(500 * time.Millisecond)
+	shutdownCountdown(st.Chat, reason, time.Second)
 
+	st.Chat.Shutdown(reason)
 	// 새 연결 막고 종료
-	_ = srv.Close()
+	for _, srv := range servers {
+		_ = srv.Close()
+	}
 	os.Exit(0)
 }
 
@@ -877,20 +2125,62 @@ func isCombiningBlock(r rune) bool {
 	}
 }
 
+// isBidiControl reports whether r is a bidirectional embedding, override or
+// isolate control. These can make text display in a different order than it
+// is stored ("Trojan Source" style right-to-left override tricks).
+func isBidiControl(r rune) bool {
+	switch {
+	case r == 0x200F: // RIGHT-TO-LEFT MARK
+		return true
+	case r >= 0x202A && r <= 0x202E: // LRE, RLE, PDF, LRO, RLO
+		return true
+	case r >= 0x2066 && r <= 0x2069: // LRI, RLI, FSI, PDI
+		return true
+	default:
+		return false
+	}
+}
+
 func isBlockedRune(r rune) bool {
 	// 범주 기반(Mn/Me) + 범위 기반을 모두 허용
 	if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) {
 		return true
 	}
-	return isCombiningBlock(r)
+	return isCombiningBlock(r) || isBidiControl(r)
 }
 
 // extractMentions finds all @username mentions in a message
 func extractMentions(text string) []string {
 	var mentions []string
-	words := strings.Fields(text)
+	text = norm.NFC.String(text) // nicks are stored in NFC
 
-	for _, word := range words {
+	// @"quoted nick" may contain spaces or punctuation. Each quoted mention
+	// is cut out of the text so the word scan below doesn't see it again.
+	var rest strings.Builder
+	for {
+		start := strings.Index(text, "@\"")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+2:], '"')
+		if end < 0 {
+			break
+		}
+		if mention := strings.TrimSpace(text[start+2 : start+2+end]); mention != "" {
+			mentions = append(mentions, mention)
+		}
+		rest.WriteString(text[:start])
+		rest.WriteByte(' ')
+		text = text[start+2+end+1:]
+	}
+	rest.WriteString(text)
+
+	for _, word := range strings.Fields(rest.String()) {
+		if strings.IndexFunc(word, isBlockedRune) >= 0 {
+			// Such text never passes ValidateNoCombining; trimming the
+			// marks off would mention a different nick.
+			continue
+		}
 		if strings.HasPrefix(word, "@") {
 			// Remove @ and any trailing punctuation
 			mention := strings.TrimPrefix(word, "@")
@@ -906,37 +2196,69 @@ func extractMentions(text string) []string {
 	return mentions
 }
 
+// mentionURIScheme is the custom scheme used for OSC 8 mention links. A
+// companion client can register a handler for it to show user profiles.
+const mentionURIScheme = "sshttp://chat/"
+
+// mentionMarkup renders @nick in bold yellow, optionally wrapped in an OSC 8
+// hyperlink pointing at the user's profile URI.
+func mentionMarkup(nick string, hyperlink bool) string {
+	highlighted := fmt.Sprintf("\x1b[1;33m@%s\x1b[0m", nick) // Bold yellow
+	if !hyperlink {
+		return highlighted
+	}
+	return osc8Link(mentionURIScheme+url.PathEscape(nick), highlighted)
+}
+
 // highlightMentions adds highlighting to mentioned usernames in the message text
-func highlightMentions(text string, mentions []string) string {
+func highlightMentions(text string, mentions []string, hyperlinks bool) string {
 	if len(mentions) == 0 {
 		return text
 	}
 
 	result := text
+	seen := make(map[string]bool, len(mentions))
 	for _, mention := range mentions {
-		// Create patterns for @username and @username with punctuation
-		pattern := "@" + mention
-		highlighted := fmt.Sprintf("\x1b[1;33m%s\x1b[0m", pattern) // Bold yellow
-		result = strings.ReplaceAll(result, pattern, highlighted)
-
-		// Also handle case where mention might have punctuation after it
-		patterns := []string{
-			"@" + mention + ",",
-			"@" + mention + ".",
-			"@" + mention + "!",
-			"@" + mention + "?",
-			"@" + mention + ":",
-			"@" + mention + ";",
-		}
-
-		for _, p := range patterns {
-			if strings.Contains(result, p) {
-				// Find the index and replace with highlighted version plus punctuation
-				parts := strings.SplitN(p, "@"+mention, 2)
-				if len(parts) == 2 {
-					highlightedWithPunct := fmt.Sprintf("\x1b[1;33m@%s\x1b[0m%s", mention, parts[1])
-					result = strings.ReplaceAll(result, p, highlightedWithPunct)
-				}
+		if seen[mention] {
+			continue
+		}
+		seen[mention] = true
+		// Highlight @"mention" first, then the unquoted form in what's left,
+		// so a quoted mention isn't wrapped twice.
+		pieces := strings.Split(result, "@\""+mention+"\"")
+		for i, piece := range pieces {
+			pieces[i] = highlightMention(piece, mention, hyperlinks)
+		}
+		result = strings.Join(pieces, mentionMarkup(mention, hyperlinks))
+	}
+
+	return result
+}
+
+// highlightMention highlights the unquoted @mention in text.
+func highlightMention(text, mention string, hyperlinks bool) string {
+	// Create patterns for @username and @username with punctuation
+	pattern := "@" + mention
+	highlighted := mentionMarkup(mention, hyperlinks)
+	result := strings.ReplaceAll(text, pattern, highlighted)
+
+	// Also handle case where mention might have punctuation after it
+	patterns := []string{
+		"@" + mention + ",",
+		"@" + mention + ".",
+		"@" + mention + "!",
+		"@" + mention + "?",
+		"@" + mention + ":",
+		"@" + mention + ";",
+	}
+
+	for _, p := range patterns {
+		if strings.Contains(result, p) {
+			// Find the index and replace with highlighted version plus punctuation
+			parts := strings.SplitN(p, "@"+mention, 2)
+			if len(parts) == 2 {
+				highlightedWithPunct := mentionMarkup(mention, hyperlinks) + parts[1]
+				result = strings.ReplaceAll(result, p, highlightedWithPunct)
 			}
 		}
 	}
@@ -947,6 +2269,9 @@ func highlightMentions(text string, mentions []string) string {
 func ValidateNoCombining(input string) error {
 	// 혹시 모를 누락을 대비해 룬 단위로 다시 점검(보수적)
 	for _, r := range input {
+		if isBidiControl(r) {
+			return errors.New("input contains bidirectional control characters (blocked)")
+		}
 		if isBlockedRune(r) {
 			return errors.New("input contains combining diacritical marks (blocked)")
 		}
@@ -0,0 +1,991 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestMain(m *testing.M) {
+	// Chat messages and audit lines are logged; keep test output readable.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const (
+	testUserIP  = "198.51.100.7"
+	testAdminIP = "192.0.2.1"
+)
+
+// setAdminIPs makes ips (comma-separated) admins for the rest of the test.
+func setAdminIPs(t *testing.T, ips string) {
+	t.Helper()
+	old := *adminIPs
+	*adminIPs = ips
+	t.Cleanup(func() { *adminIPs = old })
+}
+
+// useDefaultEasterEggs installs the built-in easter eggs for the test.
+func useDefaultEasterEggs(t *testing.T) {
+	t.Helper()
+	eggs, err := parseEasterEggs(defaultEasterEggs)
+	if err != nil {
+		t.Fatalf("parseEasterEggs: %v", err)
+	}
+	old := easterEggs
+	easterEggs = eggs
+	t.Cleanup(func() { easterEggs = old })
+}
+
+func TestClient_HandleEnter(t *testing.T) {
+	setAdminIPs(t, testAdminIP)
+	useDefaultEasterEggs(t)
+
+	tests := []struct {
+		name  string
+		input string
+		admin bool
+
+		wantNotice string // substring of the newest private notice
+		wantPublic string // substring of the newest message in the room
+		wantEgg    string // easter egg response posted after the message
+	}{
+		{name: "plain message", input: "hello there", wantPublic: "hello there"},
+		{name: "blank line", input: "   "},
+		{name: "combining marks dropped", input: "zalgo ź̂"},
+		{name: "unknown command is sent", input: "/dance now", wantPublic: "/dance now"},
+		{name: "command case-insensitive", input: "/MOTD", wantNotice: "No MOTD set."},
+		{name: "motd", input: "/motd", wantNotice: "No MOTD set."},
+		{name: "stats", input: "/stats", wantNotice: "Users: 1"},
+		{name: "top", input: "/top", wantNotice: "Top senders"},
+		{name: "uptime", input: "/uptime", wantNotice: "Server uptime"},
+		{name: "info", input: "/info", wantNotice: "Nickname: alice"},
+		{name: "version", input: "/version", wantNotice: versionString()},
+		{name: "timezone show", input: "/timezone", wantNotice: "Timezone:"},
+		{name: "timezone set", input: "/timezone Asia/Seoul", wantNotice: "Timezone set to Asia/Seoul"},
+		{name: "timezone unknown", input: "/timezone Mars/Base", wantNotice: "Unknown timezone"},
+		{name: "time 12h", input: "/time 12", wantNotice: "12-hour"},
+		{name: "time usage", input: "/time 13", wantNotice: "Usage: /time"},
+		{name: "color list", input: "/color list", wantNotice: "Available colors"},
+		{name: "report usage", input: "/report", wantNotice: "Usage: /report"},
+		{name: "reply usage", input: "/reply", wantNotice: "Usage: /reply"},
+		{name: "reply unknown id", input: "/reply 999 hi", wantNotice: "No message with ID 999"},
+		{name: "reply", input: "/reply 1 welcome indeed", wantPublic: "welcome indeed"},
+		{name: "seen usage", input: "/seen", wantNotice: "Usage: /seen"},
+		{name: "seen online", input: "/seen alice", wantNotice: "alice is currently online"},
+		{name: "seen unknown", input: "/seen nobody", wantNotice: "has not been seen"},
+		{name: "block list", input: "/block", wantNotice: "You have not blocked anyone"},
+		{name: "unblock usage", input: "/unblock", wantNotice: "Usage: /unblock"},
+		{name: "format", input: "/format off", wantNotice: "Markdown formatting disabled"},
+		{name: "accessible usage", input: "/accessible", wantNotice: "Usage: /accessible"},
+		{name: "save disabled", input: "/save", wantNotice: "/save is disabled"},
+
+		// Admin-only commands.
+		{name: "ban denied", input: "/ban 203.0.113.9", wantNotice: "Permission denied"},
+		{name: "ban invalid ip", input: "/ban nope", admin: true, wantNotice: "Invalid IP address"},
+		{name: "ban", input: "/ban 203.0.113.9", admin: true, wantNotice: "Disconnected 0 session(s).", wantPublic: "IP 203.0.113.9 banned by alice"},
+		{name: "whois denied", input: "/whois alice", wantNotice: "Permission denied"},
+		{name: "whois", input: "/whois alice", admin: true, wantNotice: "Render latency:"},
+		{name: "rename denied", input: "/rename alice bob", wantNotice: "Permission denied"},
+		{name: "rename", input: "/rename alice bob", admin: true, wantPublic: "alice has been renamed to bob"},
+		{name: "reports denied", input: "/reports", wantNotice: "Permission denied"},
+		{name: "dismiss denied", input: "/dismiss 1", wantNotice: "Permission denied"},
+		{name: "export denied", input: "/export", wantNotice: "Permission denied"},
+		{name: "shutdown denied", input: "/shutdown", wantNotice: "Permission denied"},
+		{name: "slowmode denied", input: "/slowmode 5", wantNotice: "Permission denied"},
+		{name: "slowmode", input: "/slowmode 5", admin: true, wantPublic: "Slow mode enabled"},
+		{name: "debug denied", input: "/debug", wantNotice: "Permission denied"},
+		{name: "kick-ghost denied", input: "/kick-ghost", wantNotice: "Permission denied"},
+
+		// Easter eggs.
+		{name: "egg contains", input: "why rm -rf", wantPublic: "why rm -rf", wantEgg: "파워쉘"},
+		{name: "egg regexp", input: "I like python", wantPublic: "I like python", wantEgg: "컴파일"},
+		{name: "egg java", input: "자바 좋아", wantPublic: "자바 좋아", wantEgg: "망해라 자바"},
+		{name: "egg javascript is not java", input: "자바스크립트", wantPublic: "자바스크립트", wantEgg: "jsisweird"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewServerState()
+			ip := testUserIP
+			if tt.admin {
+				ip = testAdminIP
+			}
+			c, _ := newTestClient(st, "alice", ip)
+			before := st.Chat.LastMessageID()
+
+			c.inputBuffer = []rune(tt.input)
+			c.handleEnter()
+
+			if len(c.inputBuffer) != 0 {
+				t.Errorf("input buffer not cleared: %q", string(c.inputBuffer))
+			}
+			got := notices(c)
+			if tt.wantNotice != "" {
+				if len(got) == 0 || !strings.Contains(got[len(got)-1], tt.wantNotice) {
+					t.Errorf("notices = %q, want last to contain %q", got, tt.wantNotice)
+				}
+			}
+
+			var posted []Message
+			for _, msg := range st.Chat.Messages() {
+				if msg.ID > before {
+					posted = append(posted, msg)
+				}
+			}
+			if tt.wantPublic == "" && tt.wantEgg == "" && len(posted) != 0 {
+				t.Errorf("unexpected messages: %+v", posted)
+			}
+			if tt.wantPublic != "" && (len(posted) == 0 || !strings.Contains(posted[0].Text, tt.wantPublic)) {
+				t.Errorf("posted = %+v, want first to contain %q", posted, tt.wantPublic)
+			}
+			if tt.wantEgg != "" {
+				if len(posted) < 2 || !strings.Contains(posted[len(posted)-1].Text, tt.wantEgg) {
+					t.Errorf("posted = %+v, want easter egg %q", posted, tt.wantEgg)
+				}
+			} else if tt.wantPublic != "" && len(posted) > 1 {
+				t.Errorf("unexpected easter egg: %+v", posted[1:])
+			}
+		})
+	}
+}
+
+func FuzzValidateNoCombining(f *testing.F) {
+	for _, seed := range []string{
+		"hello, world",
+		"e\u0301", // combining acute accent
+		"Z̤͔ͧ̑̓ä͖̭̈̇lͮ̒ͫǧ̗͚̚o̙̔ͮ̇͐̇", // Zalgo
+		"\u20dd\u20de", // enclosing marks (Me)
+		"abc\u202edef", // right-to-left override
+		"한국어 텍스트",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if ValidateNoCombining(s) != nil {
+			return
+		}
+		for _, r := range s {
+			if isBlockedRune(r) {
+				t.Fatalf("ValidateNoCombining accepted %q containing blocked rune %U", s, r)
+			}
+		}
+	})
+}
+
+func FuzzWrapString(f *testing.F) {
+	f.Add("hello world", 5)
+	f.Add("\x1b[31mred\x1b[0m text", 3)
+	f.Add("", 10)
+	f.Add("한국어 텍스트입니다", 4)
+	f.Add("\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", 2)
+	f.Add("abc", -1)
+	f.Fuzz(func(t *testing.T, s string, width int) {
+		if width > 1000 || width < -1000 {
+			width %= 1000
+		}
+		if lines := wrapString(s, width); len(lines) == 0 {
+			t.Fatalf("wrapString(%q, %d) returned no lines", s, width)
+		}
+	})
+}
+
+// fillHistory appends n user messages of varying length to cs.
+func fillHistory(cs *ChatServer, n int) {
+	words := strings.Fields("the quick brown fox jumps over the lazy dog while @alice reads **bold** news at https://example.com/a/rather/long/path/for/wrapping")
+	for i := 0; i < n; i++ {
+		cs.AppendMessage(Message{
+			Type:  MsgTypeUser,
+			Time:  now(),
+			Nick:  fmt.Sprintf("user%d", i%7),
+			Text:  strings.Join(words[:1+i%len(words)], " "),
+			Color: colors[i%len(colors)],
+		})
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	for _, messages := range []int{100, 1000, 10000} {
+		for _, size := range []struct{ w, h int }{{80, 24}, {200, 60}} {
+			b.Run(fmt.Sprintf("messages=%d/%dx%d", messages, size.w, size.h), func(b *testing.B) {
+				st := NewServerState()
+				fillHistory(st.Chat, messages)
+				sess := NewMockSession("alice", testUserIP)
+				sess.Sink = io.Discard
+				c := NewClient(st.Chat, sess, "alice", size.w, size.h, testUserIP, 1)
+				c.state = st
+				c.firstRender = false // no capability probe
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := c.render(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkAppendMessageConcurrent(b *testing.B) {
+	procs := []int{1, 4}
+	if n := runtime.NumCPU(); n != 1 && n != 4 {
+		procs = append(procs, n)
+	}
+	for _, p := range procs {
+		b.Run(fmt.Sprintf("GOMAXPROCS=%d", p), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(p))
+
+			st := NewServerState()
+			// Connected clients make AppendMessage walk the notification loop.
+			for i := 0; i < 50; i++ {
+				c, sess := newTestClient(st, fmt.Sprintf("user%d", i), testUserIP)
+				sess.Sink = io.Discard
+				c.firstRender = false
+			}
+			msg := Message{Type: MsgTypeUser, Nick: "bench", Text: "hello @user1", Color: 31}
+
+			var wg sync.WaitGroup
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					st.Chat.AppendMessage(msg)
+				}()
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "msgs/s")
+		})
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "at start", text: "@alice hi", want: []string{"alice"}},
+		{name: "in middle", text: "hi @alice how are you", want: []string{"alice"}},
+		{name: "at end", text: "hi @alice", want: []string{"alice"}},
+		{name: "trailing punctuation", text: "hi @alice!", want: []string{"alice"}},
+		{name: "trailing comma and colon", text: "@alice, @bob: hi", want: []string{"alice", "bob"}},
+		{name: "multiple", text: "@alice and @bob", want: []string{"alice", "bob"}},
+		{name: "duplicates are kept", text: "@alice @alice", want: []string{"alice", "alice"}},
+		{name: "underscore", text: "ping @alice_smith.", want: []string{"alice_smith"}},
+		{name: "inside URL", text: "see https://example.com/@alice", want: nil},
+		{name: "email address", text: "mail alice@example.com", want: nil},
+		{name: "bare at sign", text: "meet @ noon", want: nil},
+		{name: "only punctuation", text: "@!? what", want: nil},
+		{name: "mixed case kept", text: "@Nick hi", want: []string{"Nick"}},
+		{name: "hangul", text: "@철수 안녕", want: []string{"철수"}},
+		{name: "no mentions", text: "plain text", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractMentions(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// Text with combining marks that survive NFC is rejected by
+// ValidateNoCombining before it could be sent; extractMentions agrees and
+// ignores such words instead of trimming them down to a different nick.
+func TestExtractMentions_CombiningMarks(t *testing.T) {
+	text := "hi @zal\u0336go and @x\u0301\u0302"
+	if ValidateNoCombining(text) == nil {
+		t.Fatalf("ValidateNoCombining(%q) accepted combining marks", text)
+	}
+	if got := extractMentions(text); len(got) != 0 {
+		t.Errorf("extractMentions(%q) = %q, want none", text, got)
+	}
+}
+
+// Composed (NFC) and decomposed (NFD) spellings of a nick are the same
+// nick: logins and renames store NFC, and an NFD mention rings its owner.
+func TestNicknameNFC(t *testing.T) {
+	composed, decomposed := "caf\u00e9", "cafe\u0301"
+
+	if got := extractMentions("hi @" + decomposed); !slices.Equal(got, []string{composed}) {
+		t.Errorf("extractMentions(NFD) = %q, want [%q]", got, composed)
+	}
+	st := NewServerState()
+	if nick, _ := st.chooseNick(decomposed); nick != composed {
+		t.Errorf("chooseNick(%q) = %q, want %q", decomposed, nick, composed)
+	}
+	// Ten characters, but twenty runes before normalization.
+	if err := validateNick(strings.Repeat(decomposed[3:], 10)); err != nil {
+		t.Errorf("validateNick(10 NFD characters) = %v, want nil", err)
+	}
+
+	_, owner := newTestClient(st, composed, testUserIP)
+	sender, _ := newTestClient(st, "sender", testUserIP)
+	sender.inputBuffer = []rune("hey @" + decomposed)
+	sender.handleEnter()
+	if got := lastMessage(st.Chat).Text; got != "hey @"+composed {
+		t.Errorf("posted %q, want %q", got, "hey @"+composed)
+	}
+	if !strings.Contains(owner.Output(), "\a") {
+		t.Error("NFD mention did not ring the NFC nick")
+	}
+}
+
+// Mentions match nicknames case-insensitively: "@Nick" rings the bell of
+// the client named "nick", and nobody else's.
+func TestAppendMessage_MentionIsCaseInsensitive(t *testing.T) {
+	st := NewServerState()
+	_, mentioned := newTestClient(st, "nick", testUserIP)
+	_, other := newTestClient(st, "other", testUserIP)
+
+	st.Chat.AppendMessage(Message{Type: MsgTypeUser, Time: now(), Nick: "sender", Text: "hey @Nick!"})
+
+	if !strings.Contains(mentioned.Output(), "\a") {
+		t.Error("mentioned client did not get a bell")
+	}
+	if strings.Contains(other.Output(), "\a") {
+		t.Error("other client got a bell")
+	}
+}
+
+func TestHighlightMentions(t *testing.T) {
+	const alice = "\x1b[1;33m@alice\x1b[0m"
+	tests := []struct {
+		name     string
+		text     string
+		mentions []string
+		want     string
+	}{
+		{name: "no mentions", text: "hello @alice", mentions: nil, want: "hello @alice"},
+		{name: "bold yellow", text: "hello @alice", mentions: []string{"alice"}, want: "hello " + alice},
+		{name: "surrounding text unchanged", text: "hi @alice, how are you?", mentions: []string{"alice"}, want: "hi " + alice + ", how are you?"},
+		{name: "end of sentence", text: "thanks @alice.", mentions: []string{"alice"}, want: "thanks " + alice + "."},
+		{name: "exclamation", text: "@alice!", mentions: []string{"alice"}, want: alice + "!"},
+		{name: "same nick twice", text: "@alice @alice", mentions: []string{"alice", "alice"}, want: alice + " " + alice},
+		{
+			name:     "existing escape codes kept",
+			text:     "\x1b[31mred\x1b[0m @alice \x1b[1mbold\x1b[0m",
+			mentions: []string{"alice"},
+			want:     "\x1b[31mred\x1b[0m " + alice + " \x1b[1mbold\x1b[0m",
+		},
+		{name: "quoted", text: `hi @"alice"`, mentions: []string{"alice"}, want: "hi " + alice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlightMentions(tt.text, tt.mentions, false)
+			if got != tt.want {
+				t.Errorf("highlightMentions(%q, %q) = %q, want %q", tt.text, tt.mentions, got, tt.want)
+			}
+			if n := strings.Count(got, "\x1b[1;33m"); n != strings.Count(tt.want, "\x1b[1;33m") {
+				t.Errorf("got %d highlights in %q", n, got)
+			}
+		})
+	}
+}
+
+func TestHighlightMentions_Hyperlink(t *testing.T) {
+	got := highlightMentions("hi @alice", []string{"alice"}, true)
+	want := "hi \x1b]8;;" + mentionURIScheme + "alice\x1b\\\x1b[1;33m@alice\x1b[0m\x1b]8;;\x1b\\"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// visibleWidth counts the runes of s outside escape sequences, the width
+// model wrapString uses.
+func visibleWidth(s string) int {
+	runes := []rune(s)
+	n := 0
+	for i := 0; i < len(runes); i++ {
+		if l := escapeLen(runes[i:]); l > 0 {
+			i += l - 1
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// hasSplitEscape reports whether s contains an ESC that does not start a
+// complete escape sequence.
+func hasSplitEscape(s string) bool {
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '\x1b' {
+			continue
+		}
+		l := escapeLen(runes[i:])
+		if l == 0 {
+			return true
+		}
+		i += l - 1
+	}
+	return false
+}
+
+func TestWrapString(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		lines int
+	}{
+		{name: "ascii wider than width", s: "abcdefghijklmnopqrstuvwxyz", width: 10, lines: 3},
+		{name: "color code in the middle", s: "abcde\x1b[31mfghij\x1b[0mklmno", width: 8, lines: 2},
+		{name: "color code at break point", s: "abcde\x1b[31mfghij\x1b[0m", width: 5, lines: 2},
+		{name: "hyperlink at break point", s: "abcd\x1b]8;;https://example.com\x1b\\efgh\x1b]8;;\x1b\\", width: 4, lines: 2},
+		{name: "all CJK", s: "가나다라마바사아자차카타파하", width: 5, lines: 3},
+		{name: "shorter than width", s: "short", width: 80, lines: 1},
+		{name: "exactly width", s: "12345", width: 5, lines: 1},
+		{name: "empty", s: "", width: 10, lines: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapString(tt.s, tt.width)
+			if len(got) != tt.lines {
+				t.Errorf("wrapString(%q, %d) = %q, want %d lines", tt.s, tt.width, got, tt.lines)
+			}
+			total := 0
+			for _, line := range got {
+				w := visibleWidth(line)
+				if w > tt.width {
+					t.Errorf("line %q is %d wide, want at most %d", line, w, tt.width)
+				}
+				if hasSplitEscape(line) {
+					t.Errorf("line %q contains a split escape sequence", line)
+				}
+				total += w
+			}
+			if want := visibleWidth(tt.s); total != want {
+				t.Errorf("lines %q have visible width %d, want %d", got, total, want)
+			}
+		})
+	}
+}
+
+// Run with -race: concurrent Ban and IsBanned calls on overlapping IPs.
+func TestBanManagerConcurrency(t *testing.T) {
+	b := NewBanManager()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip := fmt.Sprintf("203.0.113.%d", i%10)
+			if i%2 == 0 {
+				b.Ban(ip)
+			} else {
+				b.IsBanned(ip)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i += 2 {
+		if ip := fmt.Sprintf("203.0.113.%d", i); !b.IsBanned(ip) {
+			t.Errorf("%s not banned", ip)
+		}
+	}
+	if ips, _ := b.Count(); ips != 5 {
+		t.Errorf("Count() = %d banned IPs, want 5", ips)
+	}
+	if got := b.Hits.Load() + b.Misses.Load(); got != 50+5 {
+		t.Errorf("Hits+Misses = %d, want 55", got)
+	}
+}
+
+func TestBanManager_BanFor_Expiry(t *testing.T) {
+	b := NewBanManager()
+	b.BanFor("203.0.113.1", 100*time.Millisecond)
+	if !b.IsBanned("203.0.113.1") {
+		t.Fatal("not banned right after BanFor")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if b.IsBanned("203.0.113.1") {
+		t.Error("still banned after the ban expired")
+	}
+	if ips, _ := b.Count(); ips != 0 {
+		t.Errorf("Count() = %d after expiry, want 0", ips)
+	}
+}
+
+func TestBanManager_BanForKeepsPermanentBan(t *testing.T) {
+	b := NewBanManager()
+	b.Ban("203.0.113.1")
+	b.BanFor("203.0.113.1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if !b.IsBanned("203.0.113.1") {
+		t.Error("BanFor shortened a permanent ban")
+	}
+}
+
+// fakeClock is a manually advanced clock for ConnectionRateLimiter.now.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.t = f.t.Add(d)
+	f.mu.Unlock()
+}
+
+func newTestRateLimiter() (*ConnectionRateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	rl := NewConnectionRateLimiter()
+	rl.now = clock.Now
+	return rl, clock
+}
+
+func TestConnectionRateLimiter_Boundary(t *testing.T) {
+	rl, clock := newTestRateLimiter()
+	for i := 1; i <= connectionsPerMinute; i++ {
+		if !rl.CheckAndRecord(testUserIP) {
+			t.Fatalf("connection %d denied, want allowed", i)
+		}
+		clock.Advance(time.Second)
+	}
+	if rl.CheckAndRecord(testUserIP) {
+		t.Fatalf("connection %d allowed, want denied", connectionsPerMinute+1)
+	}
+	if !rl.CheckAndRecord(testAdminIP) {
+		t.Error("limit on one IP denied another IP")
+	}
+
+	clock.Advance(61 * time.Second)
+	if !rl.CheckAndRecord(testUserIP) {
+		t.Error("connection denied after the window passed")
+	}
+	if got, want := rl.DeniedCount.Load(), uint64(1); got != want {
+		t.Errorf("DeniedCount = %d, want %d", got, want)
+	}
+}
+
+func TestConnectionRateLimiter_ConcurrentSameIP(t *testing.T) {
+	rl, _ := newTestRateLimiter()
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rl.CheckAndRecord(testUserIP) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != connectionsPerMinute {
+		t.Errorf("%d connections allowed, want exactly %d", got, connectionsPerMinute)
+	}
+}
+
+func TestExport_HoldsRendering(t *testing.T) {
+	setAdminIPs(t, testAdminIP)
+	st := NewServerState()
+	c, sess := newTestClient(st, "alice", testAdminIP)
+	c.firstRender = false
+	st.Chat.AppendMessage(Message{Type: MsgTypeUser, Time: now(), Nick: "bob", Text: "exported line"})
+
+	c.cmdExport("")
+	out := sess.Output()
+	if !strings.Contains(out, "bob: exported line") {
+		t.Fatalf("export output %q lacks the message", out)
+	}
+	if err := c.render(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sess.Output(); got != out {
+		t.Errorf("render overdrew the export: wrote %q", strings.TrimPrefix(got, out))
+	}
+}
+
+// Entries for IPs that stopped connecting are evicted, so a scan from many
+// addresses does not grow the limiter without bound.
+func TestConnectionRateLimiter_CleanupBoundsMemory(t *testing.T) {
+	rl, clock := newTestRateLimiter()
+	const ips = 10000
+	for i := 0; i < ips; i++ {
+		rl.CheckAndRecord(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff))
+	}
+	if got := rl.CurrentEntryCount(); got != ips {
+		t.Fatalf("CurrentEntryCount() = %d, want %d", got, ips)
+	}
+
+	clock.Advance(30 * time.Second)
+	rl.CheckAndRecord(testUserIP)
+	rl.cleanup()
+	if got := rl.CurrentEntryCount(); got != ips+1 {
+		t.Fatalf("cleanup within the window evicted entries: %d left, want %d", got, ips+1)
+	}
+
+	clock.Advance(31 * time.Second)
+	rl.cleanup()
+	if got := rl.CurrentEntryCount(); got != 1 {
+		t.Errorf("CurrentEntryCount() after cleanup = %d, want 1 (only %s is recent)", got, testUserIP)
+	}
+}
+
+// Bidirectional controls reorder how text is displayed relative to its
+// logical order (Trojan Source, CVE-2021-42574; RLO filename spoofing).
+// Messages and nicknames containing them are rejected.
+func TestBidiControlsRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "RLO filename spoof", text: "invoice_\u202efdp.exe"},
+		{name: "LRO", text: "abc\u202ddef"},
+		{name: "RLE and PDF", text: "x \u202bhidden\u202c y"},
+		{name: "LRE", text: "\u202aleft"},
+		{name: "RLM", text: "price\u200f 100"},
+		{name: "Trojan Source early return", text: "/*\u202e } \u2066if (isAdmin)\u2069 \u2066 begin admins only */"},
+		{name: "Trojan Source stretched string", text: "if access_level != \"user\u202e \u2066// Check if admin\u2069 \u2066\" {"},
+		{name: "FSI", text: "\u2068isolated\u2069"},
+		{name: "RLI", text: "\u2067rtl\u2069"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ValidateNoCombining(tt.text) == nil {
+				t.Errorf("ValidateNoCombining(%q) accepted bidi controls", tt.text)
+			}
+			if validateNick(tt.text) == nil {
+				t.Errorf("validateNick(%q) accepted bidi controls", tt.text)
+			}
+
+			st := NewServerState()
+			c, _ := newTestClient(st, "alice", testUserIP)
+			before := len(st.Chat.Messages())
+			c.inputBuffer = []rune(tt.text)
+			c.handleEnter()
+			if got := st.Chat.Messages(); len(got) != before {
+				t.Errorf("message %q was posted", got[len(got)-1].Text)
+			}
+		})
+	}
+}
+
+// Right-to-left scripts themselves are not bidi controls.
+func TestBidiControls_RTLTextAllowed(t *testing.T) {
+	for _, text := range []string{"שלום עולם", "مرحبا بالعالم", "mixed עברית and English"} {
+		if err := ValidateNoCombining(text); err != nil {
+			t.Errorf("ValidateNoCombining(%q) = %v, want nil", text, err)
+		}
+	}
+}
+
+// Invalid UTF-8 from a malformed client is dropped byte by byte in the
+// input loop; valid runes around it, including a literal U+FFFD, are kept.
+func TestInputLoop_DropsInvalidUTF8(t *testing.T) {
+	st := NewServerState()
+	c, _ := newTestClient(st, "alice", testUserIP)
+	c.firstRender = false
+
+	input := "ok\xff\xfe" + // bytes that never appear in UTF-8
+		"\xc3(" + // truncated two-byte sequence
+		"\xed\xa0\x80" + // UTF-16 surrogate half
+		"\xc0\xaf" + // overlong encoding of '/'
+		"한\ufffd"
+	before := invalidUTF8Bytes.Load()
+	c.inputLoop(bufio.NewReader(strings.NewReader(input)))
+
+	got := string(c.inputBuffer)
+	if !utf8.ValidString(got) {
+		t.Fatalf("input buffer %q is not valid UTF-8", got)
+	}
+	if want := "ok(한\ufffd"; got != want {
+		t.Errorf("input buffer = %q, want %q", got, want)
+	}
+	if dropped := invalidUTF8Bytes.Load() - before; dropped != 8 {
+		t.Errorf("invalidUTF8Bytes grew by %d, want 8", dropped)
+	}
+}
+
+// Tabs are expanded to tabSpaces before wrapping: wrapString counts a tab
+// as one column, but a terminal advances it to the next tab stop, which
+// depends on the cursor column the server does not track.
+func TestFormatMessage_ExpandsTabs(t *testing.T) {
+	msg := Message{Type: MsgTypeUser, Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Nick: "bob", Text: "name\tvalue\t\tend\tof\ta\trather\tlong\ttabbed\tline"}
+	out := strings.Join(formatMessage(msg, 200, viewOptions{}), "\n")
+	if strings.Contains(out, "\t") {
+		t.Fatalf("formatted output still contains tabs: %q", out)
+	}
+	if !strings.Contains(out, "name"+tabSpaces+"value"+tabSpaces+tabSpaces+"end") {
+		t.Errorf("tabs not expanded to %d spaces: %q", len(tabSpaces), out)
+	}
+
+	const width = 30
+	for _, line := range formatMessage(msg, width, viewOptions{}) {
+		if w := visibleWidth(line); w > width {
+			t.Errorf("line %q is %d columns wide, want at most %d", line, w, width)
+		}
+	}
+}
+
+// formatMessage draws the nick in msg.Color, never in the color of a
+// client that currently has that nick.
+func TestFormatMessage_NickColorFromMessage(t *testing.T) {
+	nickIn := func(color int, nick string) string { return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, nick) }
+	st := NewServerState()
+	impostor, _ := newTestClient(st, "server", testUserIP) // as if taken before nicks were reserved
+	impostor.color = 31
+	bob, _ := newTestClient(st, "bob", testUserIP)
+	bob.color = 35
+
+	st.Chat.AppendSystemMessage("maintenance at noon")
+	server := strings.Join(formatMessage(lastMessage(st.Chat), 80, viewOptions{}), "")
+	if want := nickIn(MsgTypeSystem.Color(), "server"); !strings.Contains(server, want) {
+		t.Errorf("server message %q lacks nick %q", server, want)
+	}
+	if strings.Contains(server, nickIn(31, "server")) {
+		t.Errorf("server message %q uses the impostor's color", server)
+	}
+
+	bob.inputBuffer = []rune("hello")
+	bob.handleEnter()
+	msg := lastMessage(st.Chat)
+	bob.color = 32 // a later /color does not repaint history
+	if got := strings.Join(formatMessage(msg, 80, viewOptions{}), ""); !strings.Contains(got, nickIn(35, "bob")) {
+		t.Errorf("user message %q lacks nick in its original color", got)
+	}
+
+	if got := strings.Join(formatMessage(Message{Nick: "old", Text: "x"}, 80, viewOptions{}), ""); !strings.Contains(got, nickIn(37, "old")) {
+		t.Errorf("message without a color %q is not drawn in white", got)
+	}
+}
+
+func TestExtractMentions_Quoted(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "quoted with space", text: `hi @"nick with space" there`, want: []string{"nick with space"}},
+		{name: "quoted with punctuation", text: `@"alice-smith!" ok`, want: []string{"alice-smith!"}},
+		{name: "quoted and plain", text: `@"a b" and @carol`, want: []string{"a b", "carol"}},
+		{name: "two quoted", text: `@"a b"@"c d"`, want: []string{"a b", "c d"}},
+		{name: "surrounding spaces trimmed", text: `@" dave " hi`, want: []string{"dave"}},
+		{name: "empty quotes", text: `@"" hi`, want: nil},
+		{name: "unterminated falls back to word", text: `@"bob hi`, want: []string{"bob"}},
+		{name: "underscore is one mention", text: "@alice_smith hi", want: []string{"alice_smith"}},
+		{name: "hyphen is one mention", text: "@alice-smith hi", want: []string{"alice-smith"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractMentions(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// @"quoted" and @alice_smith mentions reach their owner.
+func TestAppendMessage_QuotedAndUnderscoreMentions(t *testing.T) {
+	st := NewServerState()
+	_, smith := newTestClient(st, "alice_smith", testUserIP)
+	_, hyphen := newTestClient(st, "bob-jones", testUserIP)
+	_, other := newTestClient(st, "alice", testUserIP)
+
+	st.Chat.AppendMessage(Message{Type: MsgTypeUser, Time: now(), Nick: "sender", Text: `@alice_smith and @"bob-jones": lunch?`})
+	msg := lastMessage(st.Chat)
+	if want := []string{"alice_smith", "bob-jones"}; !slices.Equal(slices.Sorted(slices.Values(msg.Mentions)), want) {
+		t.Errorf("Mentions = %q, want %q", msg.Mentions, want)
+	}
+	for name, sess := range map[string]*MockSession{"alice_smith": smith, "bob-jones": hyphen} {
+		if !strings.Contains(sess.Output(), "\a") {
+			t.Errorf("%s did not get a bell", name)
+		}
+	}
+	if strings.Contains(other.Output(), "\a") {
+		t.Error("alice got a bell for @alice_smith")
+	}
+}
+
+func TestJoinLeaveSummary(t *testing.T) {
+	tests := []struct {
+		joined, left int
+		text         string
+		typ          MessageType
+	}{
+		{joined: 12, text: "12 users joined", typ: MsgTypeJoin},
+		{joined: 1, text: "1 user joined", typ: MsgTypeJoin},
+		{left: 3, text: "3 users left", typ: MsgTypeLeave},
+		{joined: 12, left: 3, text: "12 users joined, 3 left", typ: MsgTypeSystem},
+	}
+	for _, tt := range tests {
+		if got := joinLeaveSummary(tt.joined, tt.left); got != tt.text {
+			t.Errorf("joinLeaveSummary(%d, %d) = %q, want %q", tt.joined, tt.left, got, tt.text)
+		}
+		if got := joinLeaveSummaryType(tt.joined, tt.left); got != tt.typ {
+			t.Errorf("joinLeaveSummaryType(%d, %d) = %v, want %v", tt.joined, tt.left, got, tt.typ)
+		}
+	}
+}
+
+// The built-in 자바 egg keeps its original rule: the message mentions 자바
+// and nowhere mentions 자바스(크립트).
+func TestEasterEgg_Exclude(t *testing.T) {
+	eggs, err := parseEasterEggs(defaultEasterEggs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(eggs, func(e EasterEgg) bool { return e.Response == "망해라 자바" })
+	if i < 0 {
+		t.Fatal("built-in java easter egg not found")
+	}
+	java := &eggs[i]
+	for text, want := range map[string]bool{
+		"자바 좋아":      true,
+		"자바":         true,
+		"나는 자바개발자":   true,
+		"자바스크립트":     false,
+		"자바랑 자바스크립트": false,
+		"자바스":        false,
+		"코틀린":        false,
+	} {
+		if got := java.Match(text); got != want {
+			t.Errorf("Match(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+// A MOTD file that is missing at startup is picked up by the next reload.
+func TestMOTDStore_ReloadAfterFailedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "motd.txt")
+	m := &MOTDStore{}
+	if err := m.Load(path); err == nil {
+		t.Fatal("Load of a missing file succeeded")
+	}
+	if err := os.WriteFile(path, []byte("welcome\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := m.Text(); got != "welcome" {
+		t.Errorf("Text() = %q, want %q", got, "welcome")
+	}
+
+	// A broken reload keeps the last good MOTD.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err == nil {
+		t.Fatal("Reload of a missing file succeeded")
+	}
+	if got := m.Text(); got != "welcome" {
+		t.Errorf("Text() after failed reload = %q, want %q", got, "welcome")
+	}
+}
+
+func TestFinishNegotiation(t *testing.T) {
+	old := *handshakeTimeout
+	t.Cleanup(func() { *handshakeTimeout = old })
+
+	// Every session on a negotiated connection may proceed, not just the
+	// first one to stop the timer.
+	t.Run("later sessions", func(t *testing.T) {
+		*handshakeTimeout = time.Minute
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+		sess := NewMockSession("alice", testUserIP)
+		startNegotiationTimer(sess.Context(), server)
+		for i := 1; i <= 2; i++ {
+			if !finishNegotiation(sess) {
+				t.Errorf("session %d: finishNegotiation = false, want true", i)
+			}
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		*handshakeTimeout = 10 * time.Millisecond
+		server, client := net.Pipe()
+		defer client.Close()
+		sess := NewMockSession("alice", testUserIP)
+		startNegotiationTimer(sess.Context(), server)
+		_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("read = %v, want EOF from the closed connection", err)
+		}
+		if finishNegotiation(sess) {
+			t.Error("finishNegotiation = true after the timeout fired")
+		}
+	})
+}
+
+func TestCapabilityProbe_Answers(t *testing.T) {
+	tests := []struct {
+		name          string
+		sgrReport     string // DCS answer after "ESC P", empty for none
+		column        int
+		envTrueColor  bool
+		wantLinks     bool
+		wantTrueColor bool
+	}{
+		{name: "true color", sgrReport: "1$r0;48;2;1;2;3m\x1b\\", column: 2, wantLinks: true, wantTrueColor: true},
+		{name: "colon form", sgrReport: "1$r48:2::1:2:3m\x1b\\", column: 2, wantLinks: true, wantTrueColor: true},
+		{name: "BEL terminator", sgrReport: "1$r48;2;1;2;3m\a", column: 2, wantLinks: true, wantTrueColor: true},
+		{name: "color approximated", sgrReport: "1$r0;48;5;16m\x1b\\", column: 2, envTrueColor: true, wantLinks: true, wantTrueColor: false},
+		{name: "query unsupported keeps COLORTERM", sgrReport: "0$r\x1b\\", column: 2, envTrueColor: true, wantLinks: true, wantTrueColor: true},
+		{name: "no SGR report keeps COLORTERM", column: 2, envTrueColor: true, wantLinks: true, wantTrueColor: true},
+		{name: "OSC printed", sgrReport: "1$r48;2;1;2;3m\x1b\\", column: 9, wantLinks: false, wantTrueColor: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(NewServerState(), "alice", testUserIP)
+			c.caps.TrueColor = tt.envTrueColor
+			c.envCaps = c.caps
+			c.probeStatus = probePending
+
+			// The input loop has consumed each ESC; handleEscape reads the rest.
+			var answers []string
+			if tt.sgrReport != "" {
+				answers = append(answers, "P"+tt.sgrReport)
+			}
+			answers = append(answers, fmt.Sprintf("[1;%dR", tt.column))
+			for _, answer := range answers {
+				input := make(chan inputEvent, len(answer))
+				for _, r := range answer {
+					input <- inputEvent{r: r, size: utf8.RuneLen(r)}
+				}
+				c.handleEscape(input)
+			}
+
+			c.mu.Lock()
+			caps := c.caps
+			c.mu.Unlock()
+			if caps.Hyperlinks != tt.wantLinks || caps.TrueColor != tt.wantTrueColor {
+				t.Errorf("Hyperlinks, TrueColor = %t, %t; want %t, %t", caps.Hyperlinks, caps.TrueColor, tt.wantLinks, tt.wantTrueColor)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Simple markdown-like emphasis, applied by formatMessage when the client
+// has /format on. Markers must wrap non-space text on a single line.
+var (
+	mdCode   = regexp.MustCompile("`([^`\n]+)`")
+	mdBold   = regexp.MustCompile(`\*\*(\S(?:[^*\n]*\S)?)\*\*`)
+	mdStrike = regexp.MustCompile(`~~(\S(?:[^~\n]*\S)?)~~`)
+	// Underscores inside words (snake_case, nicks) are left alone.
+	mdItalic = regexp.MustCompile(`(^|[^\w])_(\S(?:[^_\n]*\S)?)_([^\w]|$)`)
+)
+
+// renderMarkdown turns **bold**, _italic_, ~~strikethrough~~ and `code`
+// into the matching SGR attributes.
+func renderMarkdown(text string) string {
+	if !strings.ContainsAny(text, "*_~`") {
+		return text
+	}
+	text = mdCode.ReplaceAllString(text, "\x1b[7m$1\x1b[27m")
+	text = mdBold.ReplaceAllString(text, "\x1b[1m$1\x1b[22m")
+	text = mdStrike.ReplaceAllString(text, "\x1b[9m$1\x1b[29m")
+	text = mdItalic.ReplaceAllString(text, "$1\x1b[3m$2\x1b[23m$3")
+	return text
+}
+
+func (c *Client) cmdFormat(arg string) {
+	var enabled bool
+	switch strings.ToLower(arg) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	case "":
+		c.mu.Lock()
+		enabled = c.markdownEnabled
+		c.mu.Unlock()
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		c.SendNotice(fmt.Sprintf("Markdown formatting is %s. Usage: /format on|off", state))
+		return
+	default:
+		c.SendNotice("Usage: /format on|off")
+		return
+	}
+	c.mu.Lock()
+	c.markdownEnabled = enabled
+	c.mu.Unlock()
+	if enabled {
+		c.SendNotice("Markdown formatting enabled.")
+	} else {
+		c.SendNotice("Markdown formatting disabled; messages are shown as sent.")
+	}
+}
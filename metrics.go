@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var metricsAddr = flag.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address, e.g. localhost:9100")
+
+// Histogram is a minimal Prometheus-style histogram of durations.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64 // upper bounds in seconds, ascending
+	counts []uint64  // observations per bucket; the last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(bounds ...time.Duration) *Histogram {
+	h := &Histogram{
+		bounds: make([]float64, len(bounds)),
+		counts: make([]uint64, len(bounds)+1),
+	}
+	for i, b := range bounds {
+		h.bounds[i] = b.Seconds()
+	}
+	return h
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// WritePrometheus writes h in the Prometheus text exposition format.
+func (h *Histogram) WritePrometheus(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, b, cumulative)
+	}
+	cumulative += h.counts[len(h.bounds)]
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.sum, name, h.count)
+}
+
+// renderLatency measures the time from a client being notified of an
+// update (e.g. by AppendMessage) until its screen has been written.
+var renderLatency = NewHistogram(
+	time.Millisecond, 5*time.Millisecond, 10*time.Millisecond,
+	50*time.Millisecond, 100*time.Millisecond, 500*time.Millisecond, time.Second,
+)
+
+func writeGauge(w io.Writer, name, help string, value any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+}
+
+func writeCounter(w io.Writer, name, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+func writeMetrics(w io.Writer, st *ServerState) {
+	writeGauge(w, "sshchat_clients", "Connected clients.", st.Chat.ClientCount())
+	writeGauge(w, "sshchat_messages", "Messages appended since start.", st.Chat.LastMessageID())
+	writeCounter(w, "sshchat_ban_hits_total", "Connections rejected because the IP is banned.", st.Bans.Hits.Load())
+	writeCounter(w, "sshchat_ban_misses_total", "Connections from IPs that are not banned.", st.Bans.Misses.Load())
+	writeCounter(w, "sshchat_ratelimit_allowed_total", "Connections allowed by the per-IP rate limiter.", st.RateLimiter.AllowedCount.Load())
+	writeCounter(w, "sshchat_ratelimit_denied_total", "Connections denied by the per-IP rate limiter.", st.RateLimiter.DeniedCount.Load())
+	writeCounter(w, "sshchat_throttle_rejected_total", "Connections rejected by the global connection throttle.", st.Throttle.RejectedCount())
+	renderLatency.WritePrometheus(w, "sshchat_render_latency_seconds", "Time from update notification to the client's screen being written.")
+}
+
+// startMetricsServer serves /metrics on addr.
+func startMetricsServer(addr string, st *ServerState) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, st)
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("starting metrics server on %s...", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("metrics server error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// MockSession is an in-memory ssh.Session for tests. Only the methods the
+// handler and Client use are implemented; the embedded nil Session makes
+// any other call panic, which points straight at the missing method.
+type MockSession struct {
+	ssh.Session
+
+	mu       sync.Mutex
+	out      bytes.Buffer
+	exitCode int
+	exited   bool
+	closed   bool
+
+	// Configurable return values.
+	UserName string
+	Addr     net.Addr
+	Env      []string
+	PtyReq   ssh.Pty
+	IsPty    bool
+	WriteErr error     // returned by Write when set
+	Sink     io.Writer // when set, writes go here instead of Output
+	Windows  chan ssh.Window
+
+	ctx    *mockContext
+	cancel context.CancelFunc
+}
+
+// NewMockSession returns a session for user connecting from ip with an
+// 80x24 xterm PTY.
+func NewMockSession(user, ip string) *MockSession {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}
+	inner, cancel := context.WithCancel(context.Background())
+	return &MockSession{
+		UserName: user,
+		Addr:     addr,
+		PtyReq:   ssh.Pty{Term: "xterm", Window: ssh.Window{Width: 80, Height: 24}},
+		IsPty:    true,
+		Windows:  make(chan ssh.Window),
+		ctx:      &mockContext{Context: inner, user: user, remote: addr},
+		cancel:   cancel,
+	}
+}
+
+func (m *MockSession) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.WriteErr != nil {
+		return 0, m.WriteErr
+	}
+	if m.Sink != nil {
+		return m.Sink.Write(p)
+	}
+	return m.out.Write(p)
+}
+
+func (m *MockSession) Exit(code int) error {
+	m.mu.Lock()
+	m.exitCode, m.exited = code, true
+	m.mu.Unlock()
+	m.cancel()
+	return nil
+}
+
+func (m *MockSession) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.cancel()
+	return nil
+}
+
+func (m *MockSession) User() string             { return m.UserName }
+func (m *MockSession) RemoteAddr() net.Addr     { return m.Addr }
+func (m *MockSession) Environ() []string        { return m.Env }
+func (m *MockSession) Context() ssh.Context     { return m.ctx }
+func (m *MockSession) PublicKey() ssh.PublicKey { return nil }
+
+func (m *MockSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	return m.PtyReq, m.Windows, m.IsPty
+}
+
+// Output returns everything written to the session so far.
+func (m *MockSession) Output() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.out.String()
+}
+
+// Exited reports whether Exit was called, and with which code.
+func (m *MockSession) Exited() (bool, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exited, m.exitCode
+}
+
+// mockContext implements ssh.Context on top of a plain context.
+type mockContext struct {
+	context.Context
+	sync.Mutex
+	user   string
+	remote net.Addr
+
+	valuesMu sync.Mutex
+	values   map[interface{}]interface{} // set by SetValue
+}
+
+func (c *mockContext) User() string          { return c.user }
+func (c *mockContext) SessionID() string     { return "mock" }
+func (c *mockContext) ClientVersion() string { return "SSH-2.0-mock" }
+func (c *mockContext) ServerVersion() string { return "SSH-2.0-mock" }
+func (c *mockContext) RemoteAddr() net.Addr  { return c.remote }
+func (c *mockContext) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+}
+func (c *mockContext) Permissions() *ssh.Permissions { return &ssh.Permissions{} }
+
+func (c *mockContext) SetValue(key, value interface{}) {
+	c.valuesMu.Lock()
+	defer c.valuesMu.Unlock()
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[key] = value
+}
+
+func (c *mockContext) Value(key interface{}) interface{} {
+	c.valuesMu.Lock()
+	v, ok := c.values[key]
+	c.valuesMu.Unlock()
+	if ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// newTestClient adds a client named nick, connected from ip, to st. The
+// client is not started; tests drive its methods directly.
+func newTestClient(st *ServerState, nick, ip string) (*Client, *MockSession) {
+	sess := NewMockSession(nick, ip)
+	c := NewClient(st.Chat, sess, nick, 80, 24, ip, 1)
+	c.state = st
+	st.Chat.AddClient(c)
+	return c, sess
+}
+
+// notices returns the text of the client's private notices.
+func notices(c *Client) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, len(c.notices))
+	for i, n := range c.notices {
+		out[i] = n.Text
+	}
+	return out
+}
+
+// lastMessage returns the newest message in the server's history.
+func lastMessage(cs *ChatServer) Message {
+	msgs := cs.Messages()
+	return msgs[len(msgs)-1]
+}
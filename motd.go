@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"sync"
+)
+
+var motdPath = flag.String("motd", "", "path to a message-of-the-day file shown to users on join (reloaded on SIGHUP)")
+
+// MOTDStore holds the message of the day last loaded from disk.
+type MOTDStore struct {
+	mu   sync.RWMutex
+	path string
+	text string
+}
+
+var motd = &MOTDStore{}
+
+// Load (re)reads the MOTD file. An empty path clears the MOTD. The path is
+// remembered even if reading fails, so that Reload can pick up the file
+// once it is fixed; the previous text is kept until then.
+func (m *MOTDStore) Load(path string) error {
+	m.mu.Lock()
+	m.path = path
+	m.mu.Unlock()
+
+	text := ""
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimRight(string(data), "\r\n")
+	}
+	m.mu.Lock()
+	m.text = text
+	m.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the file passed to the last Load call.
+func (m *MOTDStore) Reload() error {
+	m.mu.RLock()
+	path := m.path
+	m.mu.RUnlock()
+	return m.Load(path)
+}
+
+func (m *MOTDStore) Text() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.text
+}
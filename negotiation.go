@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+)
+
+var handshakeTimeout = flag.Duration("handshake-timeout", 10*time.Second, "close connections that have not completed the SSH handshake and PTY negotiation within this time (0 disables)")
+
+// negotiationTimerKey stores the per-connection *negotiation in the ssh
+// context.
+type negotiationTimerKey struct{}
+
+// negotiation states; whichever of the timer and finishNegotiation moves
+// the state away from negotiationPending first decides the outcome.
+const (
+	negotiationPending int32 = iota
+	negotiationDone
+	negotiationTimedOut
+)
+
+// negotiation is shared by every session on one connection.
+type negotiation struct {
+	timer *time.Timer
+	state atomic.Int32
+}
+
+// startNegotiationTimer is an ssh.ConnCallback that closes conn unless
+// finishNegotiation is called within -handshake-timeout. gliderlabs/ssh
+// resets socket deadlines on every read, so a timer is used instead.
+func startNegotiationTimer(ctx ssh.Context, conn net.Conn) net.Conn {
+	if *handshakeTimeout > 0 {
+		n := &negotiation{}
+		n.timer = time.AfterFunc(*handshakeTimeout, func() {
+			if !n.state.CompareAndSwap(negotiationPending, negotiationTimedOut) {
+				return
+			}
+			log.Printf("negotiation timed out after %s for %s", *handshakeTimeout, conn.RemoteAddr())
+			_ = conn.Close()
+		})
+		ctx.SetValue(negotiationTimerKey{}, n)
+	}
+	return conn
+}
+
+// finishNegotiation stops the connection's negotiation timer. It returns
+// false only if the timeout fired and the connection is being closed; later
+// sessions on an already negotiated connection get true.
+func finishNegotiation(s ssh.Session) bool {
+	n, ok := s.Context().Value(negotiationTimerKey{}).(*negotiation)
+	if !ok {
+		return true
+	}
+	n.state.CompareAndSwap(negotiationPending, negotiationDone)
+	n.timer.Stop()
+	return n.state.Load() == negotiationDone
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var reservedNicksFlag = flag.String("reserved-nicks", "", "comma-separated nicknames users may not take (\"server\" and \"broadcast\" are always reserved)")
+
+const (
+	defaultMaxNickLen = 10
+	maxNickLenLimit   = 32
+)
+
+var maxNickLen = flag.Int("max-nick-len", defaultMaxNickLen, "maximum nickname length in characters (at most 32); long nicks widen every message prefix and can crowd narrow terminals")
+
+// truncateNick shortens nick to -max-nick-len characters.
+func truncateNick(nick string) string {
+	if runes := []rune(nick); len(runes) > *maxNickLen {
+		return string(runes[:*maxNickLen])
+	}
+	return nick
+}
+
+// defaultReservedNicks appear as authors of system messages and are reserved
+// regardless of -reserved-nicks.
+var defaultReservedNicks = []string{"server", "broadcast"}
+
+// isReservedNick reports whether nick matches a reserved nickname,
+// ignoring case.
+func isReservedNick(nick string) bool {
+	reserved := slices.Concat(defaultReservedNicks, strings.Split(*reservedNicksFlag, ","))
+	for _, r := range reserved {
+		if r = strings.TrimSpace(r); r != "" && strings.EqualFold(r, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseNick derives a nickname from the SSH user name: it is normalized to
+// NFC, blank names get a guest nick, long ones are truncated, and reserved
+// ones are replaced by a guest nick and returned as reserved so the caller
+// can explain why.
+func (st *ServerState) chooseNick(user string) (nick, reserved string) {
+	nick = norm.NFC.String(strings.TrimSpace(user))
+	if nick == "" {
+		nick = st.generateGuestNickname()
+	}
+	nick = truncateNick(nick)
+	if isReservedNick(nick) {
+		return st.generateGuestNickname(), nick
+	}
+	return nick, ""
+}
+
+// validateNick checks nick against the rules applied to nicknames chosen at
+// login, returning an error suitable for showing to the user. The checks
+// apply to the NFC form of nick, which is what callers should store.
+func validateNick(nick string) error {
+	nick = norm.NFC.String(nick)
+	if nick == "" {
+		return errors.New("nickname must not be empty")
+	}
+	if n := len([]rune(nick)); n > *maxNickLen {
+		return fmt.Errorf("nickname is longer than %d characters", *maxNickLen)
+	}
+	for _, r := range nick {
+		if unicode.IsSpace(r) || isControlRune(r) || isBlockedRune(r) {
+			return errors.New("nickname contains invalid characters")
+		}
+	}
+	if isReservedNick(nick) {
+		return fmt.Errorf("nickname '%s' is reserved", nick)
+	}
+	return nil
+}
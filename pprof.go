@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+var pprofAddr = flag.String("pprof-addr", "", "development/ops: serve net/http/pprof on this address, e.g. localhost:6060 (an address without a host binds to localhost)")
+
+// startPprofServer serves the pprof handlers on their own mux so that
+// nothing else is exposed on the profiling port.
+func startPprofServer(addr string) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("starting pprof server on %s...", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("pprof server error: %v", err)
+		}
+	}()
+}
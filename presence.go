@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	rejoinSuppress = flag.Duration("rejoin-suppress", 5*time.Second, "delay leave announcements by this long and report a quick rejoin as a reconnect (0 disables)")
+	joinLeaveLimit = flag.Int("join-leave-limit", 5, "announce at most this many joins/leaves per second individually; batch the rest into a summary (0 disables)")
+)
+
+// joinLeaveWindow is the bucket size used by JoinLeaveRateLimiter.
+const joinLeaveWindow = time.Second
+
+type joinLeaveEvent struct {
+	typ  MessageType
+	text string
+}
+
+// JoinLeaveRateLimiter keeps a mass reconnect from flooding the chat with
+// join/leave lines. The first -join-leave-limit events in each one-second
+// window are posted as usual; the rest are counted and posted as a single
+// "N users joined" summary when the window closes.
+type JoinLeaveRateLimiter struct {
+	once   sync.Once
+	events chan joinLeaveEvent
+}
+
+// announce posts a join/leave message through the limiter. The accumulator
+// goroutine is started on first use so that it sees the parsed flag value.
+func (l *JoinLeaveRateLimiter) announce(cs *ChatServer, typ MessageType, text string) {
+	if *joinLeaveLimit <= 0 {
+		cs.AppendServerMessage(typ, text)
+		return
+	}
+	l.once.Do(func() {
+		l.events = make(chan joinLeaveEvent, 64)
+		go l.run(cs, *joinLeaveLimit)
+	})
+	l.events <- joinLeaveEvent{typ: typ, text: text}
+}
+
+func (l *JoinLeaveRateLimiter) run(cs *ChatServer, limit int) {
+	var (
+		count        int
+		joined, left int
+		windowC      <-chan time.Time
+	)
+	for {
+		select {
+		case ev := <-l.events:
+			if count == 0 {
+				windowC = time.After(joinLeaveWindow)
+			}
+			count++
+			if count <= limit {
+				cs.AppendServerMessage(ev.typ, ev.text)
+			} else if ev.typ == MsgTypeLeave {
+				left++
+			} else {
+				joined++
+			}
+		case <-windowC:
+			if summary := joinLeaveSummary(joined, left); summary != "" {
+				cs.AppendServerMessage(joinLeaveSummaryType(joined, left), summary)
+			}
+			count, joined, left = 0, 0, 0
+			windowC = nil
+		}
+	}
+}
+
+// joinLeaveSummary formats the batched counts, e.g. "12 users joined, 3 left".
+func joinLeaveSummary(joined, left int) string {
+	var parts []string
+	if joined > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s joined", joined, pluralUsers(joined)))
+	}
+	if left > 0 {
+		if joined > 0 {
+			parts = append(parts, fmt.Sprintf("%d left", left))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d %s left", left, pluralUsers(left)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// joinLeaveSummaryType is the message type of a summary: join or leave if
+// only one kind was batched, a neutral system message if both were.
+func joinLeaveSummaryType(joined, left int) MessageType {
+	switch {
+	case left == 0:
+		return MsgTypeJoin
+	case joined == 0:
+		return MsgTypeLeave
+	default:
+		return MsgTypeSystem
+	}
+}
+
+func pluralUsers(n int) string {
+	if n == 1 {
+		return "user"
+	}
+	return "users"
+}
+
+// AnnounceLeave reports that nick left. With -rejoin-suppress the message is
+// deferred so that AnnounceJoin can cancel it if the user comes right back.
+func (cs *ChatServer) AnnounceLeave(nick string) {
+	text := fmt.Sprintf("%s left the chat", nick)
+	if *rejoinSuppress <= 0 {
+		cs.joinLeave.announce(cs, MsgTypeLeave, text)
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(*rejoinSuppress, func() {
+		cs.pendingLeaves.CompareAndDelete(nick, timer)
+		cs.joinLeave.announce(cs, MsgTypeLeave, text)
+	})
+	// A second session with the same nick leaving replaces the first timer;
+	// announce the earlier one now rather than dropping it.
+	if prev, loaded := cs.pendingLeaves.Swap(nick, timer); loaded {
+		if prev.(*time.Timer).Stop() {
+			cs.joinLeave.announce(cs, MsgTypeLeave, text)
+		}
+	}
+}
+
+// AnnounceJoin reports that nick joined, or that it reconnected if its
+// leave announcement is still pending.
+func (cs *ChatServer) AnnounceJoin(nick string) {
+	if pending, ok := cs.pendingLeaves.LoadAndDelete(nick); ok && pending.(*time.Timer).Stop() {
+		cs.joinLeave.announce(cs, MsgTypeJoin, fmt.Sprintf("%s reconnected", nick))
+		return
+	}
+	cs.joinLeave.announce(cs, MsgTypeJoin, fmt.Sprintf("%s joined the chat", nick))
+}
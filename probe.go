@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// capabilityProbe is written before a client's first frame. From column 1
+// it writes an empty OSC 8 hyperlink, then a true-color test pixel: a space
+// with a 24-bit background, whose SGR state is queried with DECRQSS before
+// it is reset. Last it asks for the cursor position (DSR 6) and returns to
+// column 1. A terminal that parses the OSC sequence reports column
+// probeColumn, right after the pixel; one that prints the sequence's text
+// reports a later column. Answers arrive on the input stream in order, the
+// SGR report before the cursor report; see handleEscape.
+const capabilityProbe = "\r\x1b]8;;\x1b\\" +
+	"\x1b[48;2;" + probePixelRGB + "m\x1bP$qm\x1b\\ \x1b[0m" +
+	"\x1b[6n\r"
+
+// probePixelRGB is the test pixel's color. A terminal that keeps 24-bit
+// color reports it back unchanged in the DECRQSS answer.
+const probePixelRGB = "1;2;3"
+
+// probeColumn is the cursor column reported by a terminal that swallowed
+// the probe's escape sequences and printed only the pixel.
+const probeColumn = 2
+
+// maxDCSLen bounds the bytes read for one DCS string, e.g. a DECRQSS answer.
+const maxDCSLen = 64
+
+// capabilityProbeTimeout is how long to wait for the cursor report before
+// assuming a basic ANSI terminal.
+const capabilityProbeTimeout = 200 * time.Millisecond
+
+// maxCSIParams bounds the parameter bytes read for one CSI sequence.
+const maxCSIParams = 16
+
+type probeState int
+
+const (
+	probeNotSent probeState = iota
+	probePending
+	probeAnswered
+	probeTimedOut
+)
+
+// sendCapabilityProbe writes capabilityProbe and starts the timeout. The
+// caller holds renderMu.
+func (c *Client) sendCapabilityProbe() error {
+	c.mu.Lock()
+	c.probeStatus = probePending
+	c.mu.Unlock()
+	if err := c.writeFrame([]byte(capabilityProbe)); err != nil {
+		return err
+	}
+	time.AfterFunc(capabilityProbeTimeout, c.capabilityProbeTimedOut)
+	return nil
+}
+
+// capabilityProbeTimedOut falls back to basic ANSI if the terminal has not
+// answered: no hyperlinks and only the 16 standard colors.
+func (c *Client) capabilityProbeTimedOut() {
+	c.mu.Lock()
+	if c.probeStatus != probePending {
+		c.mu.Unlock()
+		return
+	}
+	c.probeStatus = probeTimedOut
+	c.caps.Hyperlinks = false
+	c.caps.Color256 = false
+	c.caps.TrueColor = false
+	c.mu.Unlock()
+	c.Notify()
+}
+
+// awaitingProbe reports whether the capability probe has been sent and not
+// yet answered, so ESC P starts its DECRQSS answer rather than Alt+Shift+P.
+func (c *Client) awaitingProbe() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.probeStatus == probePending || c.probeStatus == probeTimedOut
+}
+
+// handleSGRReport records a DECRQSS answer ("ESC P 1 $ r sgr m ESC \") to
+// the probe's SGR query. handleCursorReport applies it.
+func (c *Client) handleSGRReport(dcs string) {
+	sgr, ok := strings.CutPrefix(dcs, "1$r")
+	if !ok {
+		return // "0$r": the terminal does not support the query
+	}
+	c.mu.Lock()
+	if c.probeStatus == probePending || c.probeStatus == probeTimedOut {
+		c.probeSGR = sgr
+	}
+	c.mu.Unlock()
+}
+
+// reportsTrueColor reports whether an SGR state from DECRQSS still holds the
+// probe pixel's 24-bit background. Terminals separate the parameters with
+// ';' or ':', the latter with an empty color space ID ("48:2::1:2:3").
+func reportsTrueColor(sgr string) bool {
+	sgr = strings.TrimSuffix(sgr, "m")
+	sgr = strings.ReplaceAll(sgr, ":", ";")
+	sgr = strings.ReplaceAll(sgr, ";;", ";")
+	return strings.Contains(";"+sgr+";", ";48;2;"+probePixelRGB+";")
+}
+
+// handleCursorReport applies a DSR answer ("ESC [ row ; col R"), together
+// with the SGR report that preceded it. A late answer still counts,
+// replacing the basic ANSI fallback. Only the first report is used; later
+// ones are not prompted by us.
+func (c *Client) handleCursorReport(params string) {
+	_, colText, ok := strings.Cut(params, ";")
+	if !ok {
+		return
+	}
+	col, err := strconv.Atoi(colText)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.probeStatus != probePending && c.probeStatus != probeTimedOut {
+		c.mu.Unlock()
+		return
+	}
+	late := c.probeStatus == probeTimedOut
+	c.probeStatus = probeAnswered
+	c.caps.Probed = true
+	c.caps.Hyperlinks = col == probeColumn
+	if late {
+		// Undo the fallback; the environment's answer is better than none.
+		envCaps := c.envCaps
+		c.caps.Color256, c.caps.TrueColor = envCaps.Color256, envCaps.TrueColor
+	}
+	if c.probeSGR != "" {
+		// The terminal answered the SGR query, so it knows better than
+		// COLORTERM whether it kept the 24-bit pixel.
+		c.caps.TrueColor = reportsTrueColor(c.probeSGR)
+	}
+	caps := c.caps
+	c.mu.Unlock()
+
+	log.Printf("terminal probe ip=%s nick=%s column=%d hyperlinks=%t truecolor=%t", c.ip, c.Nick(), col, caps.Hyperlinks, caps.TrueColor)
+	c.Notify()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// renderLatencyStats tracks how long one client's render() calls take,
+// unlike the renderLatency histogram, which covers all clients and includes
+// the time spent queued. Min and Max are exact; P50 and P99 are running
+// estimates that move a small step towards each sample (frugal streaming),
+// so no samples are stored.
+type renderLatencyStats struct {
+	Samples  uint64
+	Min, Max time.Duration
+	P50, P99 time.Duration
+}
+
+// minQuantileStep keeps the quantile estimates moving when they are near 0.
+const minQuantileStep = 50 * time.Microsecond
+
+// add records one render duration.
+func (l *renderLatencyStats) add(d time.Duration) {
+	l.Samples++
+	if l.Samples == 1 {
+		l.Min, l.Max, l.P50, l.P99 = d, d, d, d
+		return
+	}
+	l.Min = min(l.Min, d)
+	l.Max = max(l.Max, d)
+	l.P50 = stepQuantile(l.P50, d, 0.50)
+	l.P99 = stepQuantile(l.P99, d, 0.99)
+}
+
+// stepQuantile nudges the estimate est of quantile q towards sample d. Over
+// many samples est settles where a fraction q of samples fall below it.
+func stepQuantile(est, d time.Duration, q float64) time.Duration {
+	step := max(est/16, minQuantileStep)
+	if d > est {
+		return min(est+time.Duration(float64(step)*q), d)
+	}
+	if d < est {
+		return max(est-time.Duration(float64(step)*(1-q)), d)
+	}
+	return est
+}
+
+// formatLatency rounds d for display: microseconds below 1ms, otherwise
+// milliseconds.
+func formatLatency(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// String is the short form used by /info, e.g. "p50=2ms p99=15ms".
+func (l renderLatencyStats) String() string {
+	if l.Samples == 0 {
+		return "no renders yet"
+	}
+	return fmt.Sprintf("p50=%s p99=%s", formatLatency(l.P50), formatLatency(l.P99))
+}
+
+// Detail is the long form used by /whois.
+func (l renderLatencyStats) Detail() string {
+	if l.Samples == 0 {
+		return "no renders yet"
+	}
+	return fmt.Sprintf("min=%s p50=%s p99=%s max=%s (%d renders)",
+		formatLatency(l.Min), formatLatency(l.P50), formatLatency(l.P99), formatLatency(l.Max), l.Samples)
+}
+
+// recordRenderLatency adds the duration of a render that started at start.
+func (c *Client) recordRenderLatency(start time.Time) {
+	d := time.Since(start)
+	c.mu.Lock()
+	c.renderStats.add(d)
+	c.mu.Unlock()
+}
+
+// RenderLatency returns a copy of the client's render latency stats.
+func (c *Client) RenderLatency() renderLatencyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.renderStats
+}
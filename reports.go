@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reportWebhook = flag.String("report-webhook", "", "URL that user reports are POSTed to as JSON")
+
+// Report is a user's flag on a message, queued for moderators.
+type Report struct {
+	ID           uint64    `json:"id"`
+	ReporterNick string    `json:"reporter_nick"`
+	TargetNick   string    `json:"target_nick"`
+	MessageID    uint64    `json:"message_id"`
+	Reason       string    `json:"reason"`
+	Time         time.Time `json:"time"`
+	Reviewed     bool      `json:"reviewed"`
+}
+
+// AddReport assigns r the next report ID, queues it and notifies any online
+// admins. The stored report is returned.
+func (cs *ChatServer) AddReport(r Report) Report {
+	cs.mu.Lock()
+	r.ID = uint64(len(cs.reports)) + 1
+	cs.reports = append(cs.reports, r)
+	cs.mu.Unlock()
+
+	logAt(severityNotice, "audit: report #%d by %s on message %d (%s): %q", r.ID, r.ReporterNick, r.MessageID, r.TargetNick, r.Reason)
+	cs.BroadcastToAdmins(fmt.Sprintf("New report #%d: %s reported message %d by %s: %s", r.ID, r.ReporterNick, r.MessageID, r.TargetNick, r.Reason))
+	return r
+}
+
+// Reports returns the queued reports, oldest first.
+func (cs *ChatServer) Reports(includeReviewed bool) []Report {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	out := make([]Report, 0, len(cs.reports))
+	for _, r := range cs.reports {
+		if includeReviewed || !r.Reviewed {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// DismissReport marks a report as reviewed. It returns false if no report
+// has that ID.
+func (cs *ChatServer) DismissReport(id uint64) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if id == 0 || id > uint64(len(cs.reports)) {
+		return false
+	}
+	cs.reports[id-1].Reviewed = true
+	return true
+}
+
+// postReportWebhook delivers r to the configured webhook, if any.
+func postReportWebhook(r Report) {
+	if *reportWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		logError("report webhook: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(*reportWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logError("report webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logError("report webhook: unexpected status %s", resp.Status)
+	}
+}
+
+func (c *Client) cmdReport(args string) {
+	idArg, reason, _ := strings.Cut(args, " ")
+	reason = strings.TrimSpace(reason)
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil || reason == "" {
+		c.SendNotice("Usage: /report <messageID> <reason>")
+		return
+	}
+	msg, ok := c.server.MessageByID(id)
+	if !ok {
+		c.SendNotice(fmt.Sprintf("No message with ID %d", id))
+		return
+	}
+	r := c.server.AddReport(Report{
+		ReporterNick: c.Nick(),
+		TargetNick:   msg.Nick,
+		MessageID:    id,
+		Reason:       reason,
+		Time:         now(),
+	})
+	go postReportWebhook(r)
+	c.SendNotice(fmt.Sprintf("Report #%d submitted. Thank you.", r.ID))
+}
+
+func (c *Client) cmdReports() {
+	if !c.requireAdmin() {
+		return
+	}
+	reports := c.server.Reports(false)
+	if len(reports) == 0 {
+		c.SendNotice("No unreviewed reports.")
+		return
+	}
+	var b strings.Builder
+	b.WriteString("Unreviewed reports:")
+	for _, r := range reports {
+		fmt.Fprintf(&b, "\n#%d [%s] %s reported message %d by %s: %s",
+			r.ID, r.Time.Format("15:04:05"), r.ReporterNick, r.MessageID, r.TargetNick, r.Reason)
+	}
+	c.SendNotice(b.String())
+}
+
+func (c *Client) cmdDismiss(arg string) {
+	if !c.requireAdmin() {
+		return
+	}
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		c.SendNotice("Usage: /dismiss <reportID>")
+		return
+	}
+	if !c.server.DismissReport(id) {
+		c.SendNotice(fmt.Sprintf("No report with ID %d", id))
+		return
+	}
+	logAt(severityNotice, "audit: report #%d dismissed by %s", id, c.Nick())
+	c.SendNotice(fmt.Sprintf("Report #%d dismissed.", id))
+}
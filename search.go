@@ -0,0 +1,50 @@
+package main
+
+import "strings"
+
+// Search mode (Ctrl+F) replaces the input line with a "/search:" prompt.
+// Typed characters edit Client.searchQuery, messages containing the query
+// are highlighted, and the view scrolls to the most recent match. ESC or
+// Enter leaves search mode.
+
+const searchHighlight = "\x1b[43m" // yellow background
+
+func (c *Client) enterSearchMode() {
+	c.mu.Lock()
+	c.searchMode = true
+	c.searchQuery = ""
+	c.mu.Unlock()
+	c.Notify()
+}
+
+func (c *Client) exitSearchMode() {
+	c.mu.Lock()
+	c.searchMode = false
+	c.searchQuery = ""
+	c.mu.Unlock()
+	c.Notify()
+}
+
+// inSearchMode reports whether keystrokes currently edit the search query.
+func (c *Client) inSearchMode() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.searchMode
+}
+
+// messageMatches reports whether msg's text contains query, ignoring case.
+// query must already be lowercased.
+func messageMatches(msg Message, query string) bool {
+	return query != "" && strings.Contains(strings.ToLower(msg.Text), query)
+}
+
+// highlightSearchLines gives formatted lines a yellow background. Resets
+// inside the lines (e.g. after a colored nick) re-apply the background.
+func highlightSearchLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\x1b[0m", "\x1b[0m"+searchHighlight)
+		out[i] = searchHighlight + line + "\x1b[0m"
+	}
+	return out
+}
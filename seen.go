@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// lastSeen is a ChatServer.lastSeen entry.
+type lastSeen struct {
+	nick string
+	at   time.Time
+}
+
+// recordSeen remembers that nick just left.
+func (cs *ChatServer) recordSeen(nick string) {
+	cs.lastSeen.Store(strings.ToLower(nick), lastSeen{nick: nick, at: now()})
+}
+
+// LastSeen returns when nick last disconnected, ignoring case.
+func (cs *ChatServer) LastSeen(nick string) (string, time.Time, bool) {
+	v, ok := cs.lastSeen.Load(strings.ToLower(nick))
+	if !ok {
+		return "", time.Time{}, false
+	}
+	seen := v.(lastSeen)
+	return seen.nick, seen.at, true
+}
+
+func (c *Client) cmdSeen(nick string) {
+	if nick == "" {
+		c.SendNotice("Usage: /seen <nick>")
+		return
+	}
+	if target := c.server.FindClient(nick); target != nil {
+		c.SendNotice(fmt.Sprintf("%s is currently online (connected %s ago)", target.Nick(), formatDuration(time.Since(target.connectedAt))))
+		return
+	}
+	name, at, ok := c.server.LastSeen(nick)
+	if !ok {
+		c.SendNotice(fmt.Sprintf("%s has not been seen since the server started", nick))
+		return
+	}
+	c.SendNotice(fmt.Sprintf("%s was last seen %s ago", name, formatDuration(time.Since(at))))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// quitCh receives OS signals and programmatic shutdown requests.
+var quitCh = make(chan os.Signal, 1)
+
+var shutdownState struct {
+	mu     sync.Mutex
+	reason string
+}
+
+// requestShutdown records why the server is shutting down and wakes up
+// main. Only the first reason is kept.
+func requestShutdown(reason string) {
+	shutdownState.mu.Lock()
+	if shutdownState.reason == "" {
+		shutdownState.reason = reason
+	}
+	shutdownState.mu.Unlock()
+
+	select {
+	case quitCh <- os.Interrupt:
+	default:
+	}
+}
+
+// ShutdownReason returns the reason passed to requestShutdown, or a
+// description of sig if the shutdown was triggered by the OS.
+func ShutdownReason(sig os.Signal) string {
+	shutdownState.mu.Lock()
+	defer shutdownState.mu.Unlock()
+	if shutdownState.reason != "" {
+		return shutdownState.reason
+	}
+	switch sig {
+	case syscall.SIGTERM:
+		return "SIGTERM from OS"
+	case syscall.SIGINT:
+		return "SIGINT from OS"
+	}
+	return sig.String() + " from OS"
+}
+
+// shutdownWaitTimeout bounds how long Shutdown waits for client goroutines.
+const shutdownWaitTimeout = 2 * time.Second
+
+// Shutdown announces reason, then closes every client session and waits
+// for the clients' goroutines to finish. Messages appended afterwards are
+// stored but no longer notify anyone.
+func (cs *ChatServer) Shutdown(reason string) {
+	cs.AppendSystemMessage(fmt.Sprintf("Server is shutting down (%s).", reason))
+	cs.WaitForRenders(900 * time.Millisecond)
+
+	// Take the client list and set the flag under one lock, so no client
+	// is notified once it has been picked for closing.
+	cs.mu.Lock()
+	cs.shutting = true
+	clients := cs.clientSnapshotLocked()
+	cs.mu.Unlock()
+
+	// Each client is torn down in its own goroutine so that one peer that
+	// stopped reading cannot hold up the others or the process exit. The
+	// session is ended first, which fails any write stuck on the peer, and
+	// only then is the client closed.
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.session.Exit(0)
+			c.Close()
+			c.Wait()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownWaitTimeout):
+		log.Printf("shutdown: timed out waiting for %d client(s)", len(clients))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlowMode returns the minimum time between two chat messages from the same
+// user, or 0 when slow mode is off.
+func (cs *ChatServer) SlowMode() time.Duration {
+	return time.Duration(cs.slowModeInterval.Load())
+}
+
+// SetSlowMode sets the slow mode interval; 0 turns slow mode off.
+func (cs *ChatServer) SetSlowMode(d time.Duration) {
+	cs.slowModeInterval.Store(int64(d))
+	for _, cl := range cs.clientSnapshot() {
+		cl.Notify() // update the status bar
+	}
+}
+
+// slowModeIndicator is the status bar text for interval, "" when off.
+func slowModeIndicator(interval time.Duration) string {
+	if interval <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" SLOW:%ds", int(interval.Round(time.Second)/time.Second))
+}
+
+// allowSlowMode reports whether c may send a chat message now, recording
+// the send if so. Admins are exempt.
+func (c *Client) allowSlowMode() bool {
+	interval := c.server.SlowMode()
+	if interval <= 0 || c.IsAdmin() {
+		return true
+	}
+	c.mu.Lock()
+	wait := interval - time.Since(c.lastChatAt)
+	if wait <= 0 {
+		c.lastChatAt = time.Now()
+	}
+	c.mu.Unlock()
+	if wait > 0 {
+		c.SendNotice(fmt.Sprintf("Slow mode is on: wait %s before sending another message.", formatDuration((wait + time.Second - 1).Truncate(time.Second))))
+		return false
+	}
+	return true
+}
+
+// cmdSlowMode handles /slowmode [seconds|off].
+func (c *Client) cmdSlowMode(arg string) {
+	if !c.requireAdmin() {
+		return
+	}
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		if d := c.server.SlowMode(); d > 0 {
+			c.SendNotice(fmt.Sprintf("Slow mode: one message every %s", formatDuration(d)))
+		} else {
+			c.SendNotice("Slow mode is off.")
+		}
+		return
+	}
+	var d time.Duration
+	if arg != "off" {
+		secs, err := strconv.Atoi(arg)
+		if err != nil || secs < 0 || secs > 3600 {
+			c.SendNotice("Usage: /slowmode <seconds 0-3600|off>")
+			return
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	c.server.SetSlowMode(d)
+	logAt(severityNotice, "audit: slowmode %s by %s (%s)", d, c.Nick(), c.ip)
+	if d > 0 {
+		c.server.AppendSystemMessage(fmt.Sprintf("Slow mode enabled: one message every %s", formatDuration(d)))
+	} else {
+		c.server.AppendSystemMessage("Slow mode disabled")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// ServerState holds the state shared by every session of one chat server.
+// main builds a single instance after parsing flags and hands it to the SSH
+// handlers; clients reach it through Client.state.
+type ServerState struct {
+	Chat        *ChatServer
+	Bans        *BanManager
+	RateLimiter *ConnectionRateLimiter
+	Throttle    *ConnectionThrottle // nil when -max-conn-per-sec is 0
+
+	guestCounter atomic.Uint64 // last numeric guest nick suffix handed out
+}
+
+func NewServerState() *ServerState {
+	st := &ServerState{
+		Chat:        NewChatServer(),
+		Bans:        NewBanManager(),
+		RateLimiter: NewConnectionRateLimiter(),
+		Throttle:    NewConnectionThrottle(*maxConnPerSec),
+	}
+	st.RateLimiter.OnNearLimit = func(ip string) {
+		st.Chat.BroadcastToAdmins(fmt.Sprintf("%s has reached the connection rate limit (%d per minute); one more connection gets it banned", ip, connectionsPerMinute))
+	}
+	return st
+}
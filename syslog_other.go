@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+func openSyslog() error {
+	return errors.New("syslog is not supported on this platform")
+}
+
+func writeSyslog(sev logSeverity, line string) {}
@@ -0,0 +1,36 @@
+//go:build !windows && !plan9
+
+package main
+
+import "log/syslog"
+
+// syslogWriter is set by openSyslog; nil means -syslog is off.
+var syslogWriter *syslog.Writer
+
+// openSyslog connects to the local syslog daemon.
+func openSyslog() error {
+	w, err := syslog.New(syslog.LOG_LOCAL0|syslog.LOG_INFO, "ssh-chat")
+	if err != nil {
+		return err
+	}
+	syslogWriter = w
+	return nil
+}
+
+func writeSyslog(sev logSeverity, line string) {
+	if syslogWriter == nil {
+		return
+	}
+	switch sev {
+	case severityNotice:
+		_ = syslogWriter.Notice(line)
+	case severityError:
+		_ = syslogWriter.Err(line)
+	case severityWarning:
+		_ = syslogWriter.Warning(line)
+	case severityCrit:
+		_ = syslogWriter.Crit(line)
+	default:
+		_ = syslogWriter.Info(line)
+	}
+}
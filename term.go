@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// TermCapabilities describes what the client's terminal is assumed to
+// support, derived from the environment the SSH client sent and refined by
+// the capability probe on the first render.
+type TermCapabilities struct {
+	Term       string
+	Color256   bool // TERM advertises a 256-color palette
+	TrueColor  bool // COLORTERM advertises 24-bit color
+	UTF8       bool // LC_ALL/LC_CTYPE/LANG select a UTF-8 locale
+	Hyperlinks bool // terminal is expected to understand OSC 8 hyperlinks
+	Probed     bool // terminal answered the capability probe, see probe.go
+}
+
+// hyperlinkTerms are TERM/TERM_PROGRAM substrings of terminals known to
+// render OSC 8 hyperlinks.
+var hyperlinkTerms = []string{"kitty", "wezterm", "iterm", "warp", "foot", "vscode"}
+
+// getSessionEnv returns the value of key from the variables the client sent
+// (e.g. with ssh -o SendEnv=COLORTERM), or "" if it was not set.
+// gliderlabs/ssh records the session's "env" requests before the PTY and
+// shell requests, so Environ is complete by the time the handler runs. If a
+// key was sent more than once the last value wins.
+func getSessionEnv(s ssh.Session, key string) string {
+	prefix := key + "="
+	value := ""
+	for _, kv := range s.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			value = kv[len(prefix):]
+		}
+	}
+	return value
+}
+
+// detectTermCapabilities inspects TERM, COLORTERM and the locale variables.
+// ptyTerm is the terminal type from the pty request, used when TERM was not
+// sent as an environment variable.
+func detectTermCapabilities(s ssh.Session, ptyTerm string) TermCapabilities {
+	term := getSessionEnv(s, "TERM")
+	if term == "" {
+		term = ptyTerm
+	}
+	colorTerm := strings.ToLower(getSessionEnv(s, "COLORTERM"))
+
+	caps := TermCapabilities{Term: term}
+	caps.TrueColor = colorTerm == "truecolor" || colorTerm == "24bit"
+	caps.Color256 = caps.TrueColor || strings.Contains(term, "256color")
+
+	// Terminals that advertise truecolor are modern enough to either render
+	// or silently ignore OSC 8; otherwise trust only known terminal names.
+	caps.Hyperlinks = caps.TrueColor
+	termProgram := strings.ToLower(getSessionEnv(s, "TERM_PROGRAM"))
+	for _, name := range hyperlinkTerms {
+		if strings.Contains(strings.ToLower(term), name) || strings.Contains(termProgram, name) {
+			caps.Hyperlinks = true
+		}
+	}
+
+	// The first non-empty of LC_ALL, LC_CTYPE and LANG decides the charset.
+	// Most clients do not forward any of them, so assume UTF-8 by default.
+	caps.UTF8 = true
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := getSessionEnv(s, key); v != "" {
+			v = strings.ToLower(v)
+			caps.UTF8 = strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+			break
+		}
+	}
+	return caps
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+	"time"
+)
+
+var maxConnPerSec = flag.Int("max-conn-per-sec", 50, "maximum new connections per second across all IPs (0 disables)")
+
+// ConnectionThrottle is a global token bucket for new connections, on top
+// of the per-IP ConnectionRateLimiter. The bucket holds up to one second's
+// worth of tokens and a goroutine refills one token every 1/rate seconds.
+type ConnectionThrottle struct {
+	tokens   atomic.Int64
+	capacity int64
+
+	// Rejected counts connections turned away because the bucket was empty.
+	Rejected atomic.Uint64
+}
+
+// NewConnectionThrottle returns a throttle allowing perSecond connections
+// per second, or nil if perSecond <= 0. A nil throttle allows everything.
+func NewConnectionThrottle(perSecond int) *ConnectionThrottle {
+	if perSecond <= 0 {
+		return nil
+	}
+	t := &ConnectionThrottle{capacity: int64(perSecond)}
+	t.tokens.Store(t.capacity)
+	go t.refillLoop(time.Second / time.Duration(perSecond))
+	return t
+}
+
+func (t *ConnectionThrottle) refillLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for {
+			n := t.tokens.Load()
+			if n >= t.capacity || t.tokens.CompareAndSwap(n, n+1) {
+				break
+			}
+		}
+	}
+}
+
+// Allow takes a token, reporting false if none are left.
+func (t *ConnectionThrottle) Allow() bool {
+	if t == nil {
+		return true
+	}
+	for {
+		n := t.tokens.Load()
+		if n <= 0 {
+			t.Rejected.Add(1)
+			return false
+		}
+		if t.tokens.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// RejectedCount returns Rejected, or 0 for a nil throttle.
+func (t *ConnectionThrottle) RejectedCount() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.Rejected.Load()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxURLPathDisplay is the number of path characters shown for a shortened URL.
+const maxURLPathDisplay = 20
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// shortenURLs replaces long URLs in text with a dim "<url: host/path...>"
+// label so that a single link does not blow up line wrapping. When the
+// terminal supports hyperlinks, the label is an OSC 8 link to the full URL.
+func shortenURLs(text string, hyperlinks bool) string {
+	return urlPattern.ReplaceAllStringFunc(text, func(m string) string {
+		u := trimURLPunct(m)
+		return shortenURL(u, hyperlinks) + m[len(u):]
+	})
+}
+
+func shortenURL(raw string, hyperlinks bool) string {
+	if !isValidURL(raw) {
+		return raw
+	}
+	rest := raw[strings.Index(raw, "://")+3:]
+	host, path, _ := strings.Cut(rest, "/")
+	pathRunes := []rune(path)
+	if len(pathRunes) <= maxURLPathDisplay {
+		return raw
+	}
+	label := "\x1b[2m<url: " + host + "/" + string(pathRunes[:maxURLPathDisplay]) + "...>\x1b[0m"
+	if !hyperlinks {
+		return label
+	}
+	return osc8Link(linkTargetEscaper.Replace(raw), label)
+}
+
+// linkTargetEscaper percent-encodes the characters renderMarkdown reacts
+// to, so that styling is never inserted into a hyperlink target.
+var linkTargetEscaper = strings.NewReplacer("*", "%2A", "_", "%5F", "~", "%7E", "`", "%60")
+
+// osc8Link wraps text in an OSC 8 hyperlink to uri.
+func osc8Link(uri, text string) string {
+	return "\x1b]8;;" + uri + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+func trimURLPunct(u string) string {
+	return strings.TrimRight(u, ".,!?;:)]'")
+}
+
+func isValidURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Host != ""
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// detectURLs returns the URLs shortenURLs would consider in text.
+func detectURLs(text string) []string {
+	var urls []string
+	for _, m := range urlPattern.FindAllString(text, -1) {
+		if u := trimURLPunct(m); isValidURL(u) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func TestURLDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "http", text: "see http://example.com", want: []string{"http://example.com"}},
+		{name: "https with path", text: "https://example.com/a/b", want: []string{"https://example.com/a/b"}},
+		{name: "query and fragment", text: "https://example.com/s?q=go&lang=ko#top", want: []string{"https://example.com/s?q=go&lang=ko#top"}},
+		{name: "port", text: "http://localhost:8080/health", want: []string{"http://localhost:8080/health"}},
+		{name: "userinfo", text: "https://user@example.com/x", want: []string{"https://user@example.com/x"}},
+		{name: "trailing period", text: "go to https://example.com/docs.", want: []string{"https://example.com/docs"}},
+		{name: "trailing comma", text: "https://a.example, https://b.example", want: []string{"https://a.example", "https://b.example"}},
+		{name: "in parentheses", text: "(https://example.com/x)", want: []string{"https://example.com/x"}},
+		{name: "angle brackets", text: "<https://example.com/x>", want: []string{"https://example.com/x"}},
+		{name: "quoted", text: `"https://example.com/x"`, want: []string{"https://example.com/x"}},
+		{name: "non-ASCII path", text: "https://ko.wikipedia.org/wiki/한국어", want: []string{"https://ko.wikipedia.org/wiki/한국어"}},
+		{name: "uppercase scheme ignored", text: "HTTPS://example.com", want: nil},
+		{name: "ftp ignored", text: "ftp://example.com/file", want: nil},
+		{name: "no host", text: "https:///path", want: nil},
+		{name: "bare domain ignored", text: "example.com/path", want: nil},
+		{name: "no URL", text: "plain text", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectURLs(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("detectURLs(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenURLs(t *testing.T) {
+	long := "https://example.com/a/very/long/path/that/goes/on?and=on"
+	label := "\x1b[2m<url: example.com/a/very/long/path/tha...>\x1b[0m"
+
+	tests := []struct {
+		name       string
+		text       string
+		hyperlinks bool
+		want       string
+	}{
+		{name: "short URL kept", text: "https://example.com/short", hyperlinks: true, want: "https://example.com/short"},
+		{name: "long URL linked", text: "see " + long + ".", hyperlinks: true, want: "see " + osc8Link(long, label) + "."},
+		{name: "no hyperlinks shows label only", text: "see " + long + ".", want: "see " + label + "."},
+		{name: "short URL kept without hyperlinks", text: "https://example.com/short", want: "https://example.com/short"},
+		{name: "markdown characters escaped in target", text: "https://example.com/some_long_path_with*stars*", hyperlinks: true,
+			want: osc8Link("https://example.com/some%5Flong%5Fpath%5Fwith%2Astars%2A", "\x1b[2m<url: example.com/some_long_path_with*...>\x1b[0m")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shortenURLs(tt.text, tt.hyperlinks); got != tt.want {
+				t.Errorf("shortenURLs(%q, %v) =\n%q, want\n%q", tt.text, tt.hyperlinks, got, tt.want)
+			}
+		})
+	}
+}
+
+// Long URLs are shortened either way; the full URL survives formatting only
+// as the link target on terminals that support hyperlinks.
+func TestFormatMessage_ShortensURL(t *testing.T) {
+	long := "https://example.com/a/very/long/path/that/goes/on"
+	msg := Message{Type: MsgTypeUser, Nick: "bob", Text: "read " + long}
+	for _, hyperlinks := range []bool{false, true} {
+		out := strings.Join(formatMessage(msg, 200, viewOptions{hyperlinks: hyperlinks, markdown: true}), "")
+		if !strings.Contains(out, "<url: example.com/a/very/long/path/tha...>") {
+			t.Errorf("hyperlinks=%v: formatted %q lacks the shortened label", hyperlinks, out)
+		}
+		if got := strings.Contains(out, long); got != hyperlinks {
+			t.Errorf("hyperlinks=%v: full URL present = %v in %q", hyperlinks, got, out)
+		}
+	}
+}